@@ -28,14 +28,26 @@ type Response struct {
 	Data any    `json:"data,omitempty"`
 }
 
+// ErrorMapper translates an error into an HTTP status and response
+// code. ok is false if the error is not recognized.
+type ErrorMapper func(err error) (status int, code int, ok bool)
+
 type Handler struct {
 	errCodes map[error]int
+	mappers  []ErrorMapper
 }
 
 func New(errCodes map[error]int) *Handler {
 	return &Handler{errCodes: errCodes}
 }
 
+// AddErrorMapper registers a mapper consulted for errors not found in
+// the error code table. Mappers are tried in registration order.
+func (h *Handler) AddErrorMapper(m ErrorMapper) *Handler {
+	h.mappers = append(h.mappers, m)
+	return h
+}
+
 type handleFunc any
 
 func (h *Handler) Handle(fn handleFunc) gin.HandlerFunc {
@@ -180,19 +192,37 @@ func validateFunc(fn handleFunc) error {
 }
 
 func (h *Handler) errResponse(c *gin.Context, err error) {
-	log.Error("Error requesting the api server",
+	log.FromContext(c.Request.Context()).Error("Error requesting the api server",
 		"url", c.Request.URL,
 		"request_body", c.Value(reqBodyLabel),
 		"error", err,
 	)
-	code := getErrCode(err, h.errCodes)
+	status, code := h.classify(err)
 	msg := err.Error()
-	c.AbortWithStatusJSON(http.StatusBadRequest, Response{
+	c.AbortWithStatusJSON(status, Response{
 		Code: code,
 		Msg:  msg,
 	})
 }
 
+// classify returns the HTTP status and response code for err.
+// The error code table takes precedence and always responds with
+// http.StatusBadRequest.
+func (h *Handler) classify(err error) (int, int) {
+	code := getErrCode(err, h.errCodes)
+	if code != -1 {
+		return http.StatusBadRequest, code
+	}
+
+	for _, m := range h.mappers {
+		if status, code, ok := m(err); ok {
+			return status, code
+		}
+	}
+
+	return http.StatusBadRequest, code
+}
+
 func getErrCode(err error, errorCodes map[error]int) int {
 	if ok := isComparable(reflect.TypeOf(err)); ok {
 		if errCode, ok := errorCodes[err]; ok {
@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 
 	"github.com/photon-storage/go-common/api/pagination"
+	"github.com/photon-storage/go-common/testing/require"
 )
 
 func TestValidateFunc(t *testing.T) {
@@ -89,3 +92,28 @@ func TestValidateFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestClassify(t *testing.T) {
+	errKnown := errors.New("known")
+	errConflict := errors.New("conflict")
+
+	h := New(map[error]int{errKnown: 1001}).
+		AddErrorMapper(func(err error) (int, int, bool) {
+			if errors.Is(err, errConflict) {
+				return http.StatusConflict, http.StatusConflict, true
+			}
+			return 0, 0, false
+		})
+
+	status, code := h.classify(errKnown)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, 1001, code)
+
+	status, code = h.classify(errors.Wrap(errConflict, "insert"))
+	require.Equal(t, http.StatusConflict, status)
+	require.Equal(t, http.StatusConflict, code)
+
+	status, code = h.classify(errors.New("unknown"))
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, -1, code)
+}
@@ -1,12 +1,48 @@
 package mysql
 
+import (
+	"time"
+)
+
 // Config defines mysql configuration.
 type Config struct {
-	Master       Conn   `yaml:"master"`
-	Slaves       []Conn `yaml:"slaves"`
+	Master Conn   `yaml:"master"`
+	Slaves []Conn `yaml:"slaves"`
+	// MaxOpenConns and MaxIdleConns apply to both master and slaves
+	// unless overridden in MasterPool or SlavePool.
 	MaxOpenConns int    `yaml:"max_open_conns"`
 	MaxIdleConns int    `yaml:"max_idle_conns"`
 	LogLevel     string `yaml:"log_level"`
+
+	// MasterPool and SlavePool tune the connection pools per role.
+	// Each slave gets its own pool sized by SlavePool.
+	MasterPool PoolConfig `yaml:"master_pool"`
+	SlavePool  PoolConfig `yaml:"slave_pool"`
+	// CreateBatchSize is the default batch size for batch inserts.
+	CreateBatchSize int `yaml:"create_batch_size"`
+
+	// Metrics exports pool stats and query latency through the
+	// metrics package.
+	Metrics bool `yaml:"metrics"`
+
+	// SlowThreshold is the latency above which queries are logged as
+	// slow. Defaults to 200ms. A negative value disables it.
+	SlowThreshold time.Duration `yaml:"slow_threshold"`
+	// RedactParams hides literal values in logged statements.
+	RedactParams bool `yaml:"redact_params"`
+
+	// HealthCheck ejects unhealthy or lagging slaves from reads.
+	HealthCheck HealthCheckConfig `yaml:"health_check"`
+	// Policy selects slaves for reads: random (default),
+	// weighted_random, round_robin, least_in_flight or ewma_latency.
+	Policy string `yaml:"policy"`
+	// ReadYourWritesWindow routes reads to the master for the given
+	// duration after a write with the same tracked context. Zero
+	// disables it. See WithWriteTracking.
+	ReadYourWritesWindow time.Duration `yaml:"read_your_writes_window"`
+
+	// Startup controls waiting for the cluster in NewMySQLDB.
+	Startup StartupConfig `yaml:"startup"`
 }
 
 type Conn struct {
@@ -15,4 +51,56 @@ type Conn struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	DBName   string `yaml:"db_name"`
+
+	// PasswordFile and PasswordEnv read the password from a file or
+	// an environment variable instead of the plaintext Password. They
+	// are re-read every PasswordRefreshInterval (default 1m) so new
+	// connections pick up rotated credentials.
+	PasswordFile            string        `yaml:"password_file"`
+	PasswordEnv             string        `yaml:"password_env"`
+	PasswordRefreshInterval time.Duration `yaml:"password_refresh_interval"`
+	// SecretProvider plugs in a custom password source. It can only
+	// be set programmatically.
+	SecretProvider SecretProvider `yaml:"-"`
+
+	// Weight is the relative share of reads for a slave under the
+	// weighted_random policy. Defaults to 1. Ignored for the master.
+	Weight int `yaml:"weight"`
+
+	// TLS enables TLS on the connection when set.
+	TLS *TLSConfig `yaml:"tls"`
+
+	// Timeout is the dial timeout. ReadTimeout and WriteTimeout are
+	// the I/O timeouts. Zero leaves the driver default in place.
+	Timeout      time.Duration `yaml:"timeout"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// Collation sets the connection collation. Empty uses the
+	// driver default.
+	Collation string `yaml:"collation"`
+
+	// InterpolateParams interpolates placeholders into the query
+	// string instead of using server-side prepared statements.
+	InterpolateParams bool `yaml:"interpolate_params"`
+
+	// Params holds extra DSN parameters passed to the driver as is,
+	// e.g. system variables like "time_zone" or "sql_mode". It takes
+	// precedence over the default charset.
+	Params map[string]string `yaml:"params"`
+}
+
+// TLSConfig defines TLS settings for a mysql connection.
+type TLSConfig struct {
+	// CAFile is the PEM encoded CA bundle used to verify the server.
+	// The system pool is used if empty.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the PEM encoded client certificate
+	// and key. Both must be set for client authentication.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName overrides the host name used for verification.
+	ServerName string `yaml:"server_name"`
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
 }
@@ -0,0 +1,42 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+// connector establishes driver connections, fetching the password from
+// the secret provider for every new connection so rotated credentials
+// take effect without reopening the pool.
+type connector struct {
+	cfg    *gomysql.Config
+	secret SecretProvider
+}
+
+func newConnector(cfg *gomysql.Config, secret SecretProvider) *connector {
+	return &connector{
+		cfg:    cfg,
+		secret: secret,
+	}
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	passwd, err := c.secret.Secret(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := c.cfg.Clone()
+	cfg.Passwd = passwd
+	conn, err := gomysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return conn.Connect(ctx)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return gomysql.MySQLDriver{}
+}
@@ -0,0 +1,194 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type writeTrackerKey struct{}
+
+// writeTracker records the time of the last write in a request or
+// session.
+type writeTracker struct {
+	last int64
+	// session and token are set when writes are shared through a
+	// SessionTracker.
+	session *SessionTracker
+	token   string
+}
+
+func (t *writeTracker) markWrite() {
+	if t.session != nil {
+		t.session.markWrite(t.token)
+		return
+	}
+	atomic.StoreInt64(&t.last, time.Now().UnixNano())
+}
+
+func (t *writeTracker) wroteWithin(window time.Duration) bool {
+	if t.session != nil {
+		return t.session.wroteWithin(t.token, window)
+	}
+	last := atomic.LoadInt64(&t.last)
+	return last != 0 && time.Since(time.Unix(0, last)) < window
+}
+
+// Primary returns a session bound to ctx that reads from the master.
+func Primary(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.WithContext(ctx).Clauses(dbresolver.Write)
+}
+
+// WithWriteTracking returns a context that tracks writes issued with
+// it. Reads issued with the same context are routed to the master for
+// the read-your-writes window after a write.
+func WithWriteTracking(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(writeTrackerKey{}).(*writeTracker); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, writeTrackerKey{}, &writeTracker{})
+}
+
+// SessionTracker shares write tracking across requests carrying the
+// same session token, e.g. a client reading right after its own
+// write in a previous request. Tokens are kept in memory from their
+// first write until ttl after their last write.
+type SessionTracker struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	lastWrite map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewSessionTracker(ttl time.Duration) *SessionTracker {
+	return &SessionTracker{
+		ttl:       ttl,
+		lastWrite: map[string]time.Time{},
+		lastSweep: time.Now(),
+	}
+}
+
+// WithSession returns a context tracking writes for the session token.
+func (s *SessionTracker) WithSession(
+	ctx context.Context,
+	token string,
+) context.Context {
+	return context.WithValue(ctx, writeTrackerKey{}, &writeTracker{
+		session: s,
+		token:   token,
+	})
+}
+
+func (s *SessionTracker) markWrite(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > s.ttl {
+		for k, last := range s.lastWrite {
+			if now.Sub(last) >= s.ttl {
+				delete(s.lastWrite, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.lastWrite[token] = now
+}
+
+func (s *SessionTracker) wroteWithin(token string, window time.Duration) bool {
+	s.mu.Lock()
+	last, ok := s.lastWrite[token]
+	s.mu.Unlock()
+	return ok && time.Since(last) < window
+}
+
+// WriteTrackingMiddleware enables write tracking on the request
+// context. If sessions is set and the request carries the given
+// header, tracking is shared by all requests with the same value.
+// Handlers must pass c.Request.Context() to gorm via WithContext.
+func WriteTrackingMiddleware(
+	sessions *SessionTracker,
+	header string,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if token := c.GetHeader(header); sessions != nil && token != "" {
+			ctx = sessions.WithSession(ctx, token)
+		} else {
+			ctx = WithWriteTracking(ctx)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// ReadYourWritesPlugin is a gorm plugin routing reads to the master
+// for a window after a write issued with the same tracked context.
+// See WithWriteTracking and SessionTracker.
+type ReadYourWritesPlugin struct {
+	window time.Duration
+}
+
+func NewReadYourWritesPlugin(window time.Duration) *ReadYourWritesPlugin {
+	return &ReadYourWritesPlugin{window: window}
+}
+
+func (p *ReadYourWritesPlugin) Name() string {
+	return "photon:read_your_writes"
+}
+
+func (p *ReadYourWritesPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, c := range []struct {
+		name string
+		reg  callbackRegisterer
+		fn   func(*gorm.DB)
+	}{
+		{"after_create", cb.Create().After("gorm:create"), p.markWrite},
+		{"after_update", cb.Update().After("gorm:update"), p.markWrite},
+		{"after_delete", cb.Delete().After("gorm:delete"), p.markWrite},
+		{"after_raw", cb.Raw().After("gorm:raw"), p.markRawWrite},
+		{"before_query", cb.Query().Before("gorm:query"), p.pinRead},
+		{"before_row", cb.Row().Before("gorm:row"), p.pinRead},
+	} {
+		if err := c.reg.Register("read_your_writes:"+c.name, c.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tracker(db *gorm.DB) *writeTracker {
+	if db.Statement.Context == nil {
+		return nil
+	}
+	t, _ := db.Statement.Context.Value(writeTrackerKey{}).(*writeTracker)
+	return t
+}
+
+func (p *ReadYourWritesPlugin) markWrite(db *gorm.DB) {
+	if t := tracker(db); t != nil && db.Error == nil {
+		t.markWrite()
+	}
+}
+
+func (p *ReadYourWritesPlugin) markRawWrite(db *gorm.DB) {
+	sql := strings.TrimSpace(db.Statement.SQL.String())
+	if len(sql) >= 6 && strings.EqualFold(sql[:6], "select") {
+		return
+	}
+	p.markWrite(db)
+}
+
+func (p *ReadYourWritesPlugin) pinRead(db *gorm.DB) {
+	if t := tracker(db); t != nil && t.wroteWithin(p.window) {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
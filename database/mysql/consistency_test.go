@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+type consistencyTestRow struct {
+	ID   uint64
+	Name string
+}
+
+func dryRunCluster(t *testing.T) (*gorm.DB, *sql.DB, *sql.DB) {
+	master := unreachableDB(t)
+	slave := unreachableDB(t)
+	dialector := func(db *sql.DB) gorm.Dialector {
+		return mysql.New(mysql.Config{
+			Conn:                      db,
+			SkipInitializeWithVersion: true,
+		})
+	}
+
+	db, err := gorm.Open(dialector(master), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(dbresolver.Register(dbresolver.Config{
+		Sources:  []gorm.Dialector{dialector(master)},
+		Replicas: []gorm.Dialector{dialector(slave)},
+	})))
+	return db, master, slave
+}
+
+func TestReadYourWrites(t *testing.T) {
+	db, master, slave := dryRunCluster(t)
+	require.NoError(t, db.Use(NewReadYourWritesPlugin(time.Minute)))
+
+	var rows []consistencyTestRow
+	ctx := WithWriteTracking(context.Background())
+	tx := db.WithContext(ctx).Find(&rows)
+	require.NoError(t, tx.Error)
+	require.Equal(t, gorm.ConnPool(slave), tx.Statement.ConnPool)
+
+	require.NoError(t, db.WithContext(ctx).
+		Create(&consistencyTestRow{Name: "a"}).Error)
+	tx = db.WithContext(ctx).Find(&rows)
+	require.NoError(t, tx.Error)
+	require.Equal(t, gorm.ConnPool(master), tx.Statement.ConnPool)
+
+	// Other requests are not affected.
+	tx = db.WithContext(WithWriteTracking(context.Background())).Find(&rows)
+	require.Equal(t, gorm.ConnPool(slave), tx.Statement.ConnPool)
+
+	// Untracked context.
+	tx = db.WithContext(context.Background()).Find(&rows)
+	require.Equal(t, gorm.ConnPool(slave), tx.Statement.ConnPool)
+}
+
+func TestSessionTracker(t *testing.T) {
+	db, master, slave := dryRunCluster(t)
+	require.NoError(t, db.Use(NewReadYourWritesPlugin(time.Minute)))
+	sessions := NewSessionTracker(time.Minute)
+
+	var rows []consistencyTestRow
+	ctx := sessions.WithSession(context.Background(), "token-a")
+	require.NoError(t, db.WithContext(ctx).
+		Create(&consistencyTestRow{Name: "a"}).Error)
+
+	// A later request with the same token reads from master.
+	ctx = sessions.WithSession(context.Background(), "token-a")
+	tx := db.WithContext(ctx).Find(&rows)
+	require.Equal(t, gorm.ConnPool(master), tx.Statement.ConnPool)
+
+	ctx = sessions.WithSession(context.Background(), "token-b")
+	tx = db.WithContext(ctx).Find(&rows)
+	require.Equal(t, gorm.ConnPool(slave), tx.Statement.ConnPool)
+}
+
+func TestPrimary(t *testing.T) {
+	db, master, _ := dryRunCluster(t)
+
+	var rows []consistencyTestRow
+	tx := Primary(context.Background(), db).Find(&rows)
+	require.NoError(t, tx.Error)
+	require.Equal(t, gorm.ConnPool(master), tx.Statement.ConnPool)
+}
+
+func TestSessionTrackerSweep(t *testing.T) {
+	db, master, slave := dryRunCluster(t)
+	require.NoError(t, db.Use(NewReadYourWritesPlugin(time.Minute)))
+	sessions := NewSessionTracker(50 * time.Millisecond)
+
+	// Read only sessions are not kept.
+	var rows []consistencyTestRow
+	ctx := sessions.WithSession(context.Background(), "token-a")
+	tx := db.WithContext(ctx).Find(&rows)
+	require.Equal(t, gorm.ConnPool(slave), tx.Statement.ConnPool)
+	require.Equal(t, 0, len(sessions.lastWrite))
+
+	// A request in flight across a sweep still records its write.
+	inFlight := sessions.WithSession(context.Background(), "token-a")
+	require.NoError(t, db.WithContext(ctx).
+		Create(&consistencyTestRow{Name: "a"}).Error)
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, db.WithContext(
+		sessions.WithSession(context.Background(), "token-b"),
+	).Create(&consistencyTestRow{Name: "b"}).Error)
+	_, ok := sessions.lastWrite["token-a"]
+	require.False(t, ok)
+
+	require.NoError(t, db.WithContext(inFlight).
+		Create(&consistencyTestRow{Name: "c"}).Error)
+	ctx = sessions.WithSession(context.Background(), "token-a")
+	tx = db.WithContext(ctx).Find(&rows)
+	require.Equal(t, gorm.ConnPool(master), tx.Statement.ConnPool)
+}
@@ -0,0 +1,116 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// DSNConfig builds the driver configuration for the connection.
+// A TLS configuration, if any, is registered with the driver under a
+// key derived from the connection address and the TLS settings, so
+// connections to the same address with different settings do not
+// replace each other's registration.
+func (c Conn) DSNConfig() (*gomysql.Config, error) {
+	cfg := gomysql.NewConfig()
+	cfg.User = c.Username
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = c.addr()
+	cfg.DBName = c.DBName
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.Timeout = c.Timeout
+	cfg.ReadTimeout = c.ReadTimeout
+	cfg.WriteTimeout = c.WriteTimeout
+	cfg.InterpolateParams = c.InterpolateParams
+	if c.Collation != "" {
+		cfg.Collation = c.Collation
+	}
+
+	cfg.Params = map[string]string{
+		"charset": "utf8mb4",
+	}
+	for k, v := range c.Params {
+		cfg.Params[k] = v
+	}
+
+	if c.TLS != nil {
+		tlsCfg, err := c.TLS.build()
+		if err != nil {
+			return nil, errors.Wrapf(err, "build tls config for %s", cfg.Addr)
+		}
+
+		key := "conn-" + cfg.Addr + "-" + c.TLS.hash()
+		if err := gomysql.RegisterTLSConfig(key, tlsCfg); err != nil {
+			return nil, errors.Wrapf(err, "register tls config for %s", cfg.Addr)
+		}
+		cfg.TLSConfig = key
+	}
+
+	return cfg, nil
+}
+
+// DSN returns the formatted data source name for the connection.
+func (c Conn) DSN() (string, error) {
+	cfg, err := c.DSNConfig()
+	if err != nil {
+		return "", err
+	}
+	return cfg.FormatDSN(), nil
+}
+
+func (c Conn) addr() string {
+	return net.JoinHostPort(c.Host, strconv.FormatUint(uint64(c.Port), 10))
+}
+
+// hash identifies the TLS settings.
+func (t *TLSConfig) hash() string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%q %q %q %q %t",
+		t.CAFile,
+		t.CertFile,
+		t.KeyFile,
+		t.ServerName,
+		t.InsecureSkipVerify,
+	)))
+	return hex.EncodeToString(h[:8])
+}
+
+func (t *TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
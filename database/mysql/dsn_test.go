@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestDSN(t *testing.T) {
+	c := Conn{
+		Host:              "db.local",
+		Port:              3306,
+		Username:          "user",
+		Password:          "p@ss/w:rd",
+		DBName:            "photon",
+		Timeout:           5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      15 * time.Second,
+		Collation:         "utf8mb4_unicode_ci",
+		InterpolateParams: true,
+		Params: map[string]string{
+			"time_zone": "'+00:00'",
+		},
+	}
+
+	dsn, err := c.DSN()
+	require.NoError(t, err)
+
+	parsed, err := gomysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	require.Equal(t, "user", parsed.User)
+	require.Equal(t, "p@ss/w:rd", parsed.Passwd)
+	require.Equal(t, "tcp", parsed.Net)
+	require.Equal(t, "db.local:3306", parsed.Addr)
+	require.Equal(t, "photon", parsed.DBName)
+	require.Equal(t, 5*time.Second, parsed.Timeout)
+	require.Equal(t, 10*time.Second, parsed.ReadTimeout)
+	require.Equal(t, 15*time.Second, parsed.WriteTimeout)
+	require.Equal(t, "utf8mb4_unicode_ci", parsed.Collation)
+	require.True(t, parsed.InterpolateParams)
+	require.True(t, parsed.ParseTime)
+	require.Equal(t, time.UTC, parsed.Loc)
+	require.Equal(t, "utf8mb4", parsed.Params["charset"])
+	require.Equal(t, "'+00:00'", parsed.Params["time_zone"])
+}
+
+func TestDSNParamsOverrideCharset(t *testing.T) {
+	c := Conn{
+		Host:   "127.0.0.1",
+		Port:   3306,
+		Params: map[string]string{"charset": "latin1"},
+	}
+
+	cfg, err := c.DSNConfig()
+	require.NoError(t, err)
+	require.Equal(t, "latin1", cfg.Params["charset"])
+}
+
+func TestDSNTLS(t *testing.T) {
+	c := Conn{
+		Host: "127.0.0.1",
+		Port: 3307,
+		TLS: &TLSConfig{
+			ServerName:         "mysql.internal",
+			InsecureSkipVerify: true,
+		},
+	}
+
+	cfg, err := c.DSNConfig()
+	require.NoError(t, err)
+	require.Equal(t, "conn-127.0.0.1:3307-"+c.TLS.hash(), cfg.TLSConfig)
+
+	// The same settings share a key, different ones do not.
+	same, err := c.DSNConfig()
+	require.NoError(t, err)
+	require.Equal(t, cfg.TLSConfig, same.TLSConfig)
+
+	other := c
+	other.TLS = &TLSConfig{ServerName: "mysql.internal"}
+	otherCfg, err := other.DSNConfig()
+	require.NoError(t, err)
+	require.NotEqual(t, cfg.TLSConfig, otherCfg.TLSConfig)
+
+	c.TLS.CAFile = "/nonexistent/ca.pem"
+	_, err = c.DSNConfig()
+	require.ErrorContains(t, "build tls config", err)
+}
@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ApplyEnv overrides config values from environment variables. The
+// variable name is the prefix followed by the upper-cased yaml path
+// joined with '_', e.g. with prefix "MYSQL":
+//
+//	MYSQL_MASTER_HOST, MYSQL_MASTER_PASSWORD_FILE,
+//	MYSQL_SLAVES_0_HOST, MYSQL_MASTER_POOL_MAX_OPEN_CONNS
+//
+// Slaves can only be overridden by index for entries present in the
+// config. Durations use time.ParseDuration syntax.
+func (c *Config) ApplyEnv(prefix string) error {
+	_, err := applyEnv(reflect.ValueOf(c).Elem(), prefix, os.LookupEnv)
+	return err
+}
+
+// applyEnv walks struct fields by yaml tag and sets those with a
+// matching variable. It reports whether any value was set.
+func applyEnv(
+	v reflect.Value,
+	name string,
+	lookup func(string) (string, bool),
+) (bool, error) {
+	switch {
+	case v.Type() == durationType:
+		s, ok := lookup(name)
+		if !ok {
+			return false, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return false, errors.Wrap(err, name)
+		}
+		v.SetInt(int64(d))
+		return true, nil
+
+	case v.Kind() == reflect.Struct:
+		set := false
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			tag := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			ok, err := applyEnv(v.Field(i), name+"_"+strings.ToUpper(tag), lookup)
+			if err != nil {
+				return false, err
+			}
+			set = set || ok
+		}
+		return set, nil
+
+	case v.Kind() == reflect.Ptr:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return false, nil
+		}
+		// Allocate missing structs, keeping them only if a variable
+		// was found.
+		elem := v
+		if v.IsNil() {
+			elem = reflect.New(v.Type().Elem())
+		}
+		ok, err := applyEnv(elem.Elem(), name, lookup)
+		if err != nil {
+			return false, err
+		}
+		if ok && v.IsNil() {
+			v.Set(elem)
+		}
+		return ok, nil
+
+	case v.Kind() == reflect.Slice:
+		set := false
+		for i := 0; i < v.Len(); i++ {
+			ok, err := applyEnv(v.Index(i), name+"_"+strconv.Itoa(i), lookup)
+			if err != nil {
+				return false, err
+			}
+			set = set || ok
+		}
+		return set, nil
+	}
+
+	s, ok := lookup(name)
+	if !ok {
+		return false, nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, errors.Wrap(err, name)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return false, errors.Wrap(err, name)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return false, errors.Wrap(err, name)
+		}
+		v.SetUint(n)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
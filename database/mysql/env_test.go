@@ -0,0 +1,57 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"MYSQL_MASTER_HOST":                 "master.prod",
+		"MYSQL_MASTER_PORT":                 "3307",
+		"MYSQL_MASTER_PASSWORD_ENV":         "DB_PASS",
+		"MYSQL_MASTER_TLS_SERVER_NAME":      "mysql.prod",
+		"MYSQL_SLAVES_1_HOST":               "replica1.prod",
+		"MYSQL_SLAVES_2_HOST":               "ignored",
+		"MYSQL_SLAVE_POOL_MAX_OPEN_CONNS":   "300",
+		"MYSQL_HEALTH_CHECK_ENABLED":        "true",
+		"MYSQL_HEALTH_CHECK_MAX_LAG":        "30s",
+		"MYSQL_MASTER_INTERPOLATE_PARAMS":   "1",
+		"MYSQL_MASTER_PASSWORD_REFRESH_INT": "ignored",
+	}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	cfg := Config{
+		Master: Conn{Host: "localhost", Port: 3306},
+		Slaves: []Conn{{Host: "replica0"}, {Host: "replica1"}},
+	}
+	_, err := applyEnv(reflect.ValueOf(&cfg).Elem(), "MYSQL", lookup)
+	require.NoError(t, err)
+	require.Equal(t, "master.prod", cfg.Master.Host)
+	require.Equal(t, uint(3307), cfg.Master.Port)
+	require.Equal(t, "DB_PASS", cfg.Master.PasswordEnv)
+	require.True(t, cfg.Master.InterpolateParams)
+	require.NotNil(t, cfg.Master.TLS)
+	require.Equal(t, "mysql.prod", cfg.Master.TLS.ServerName)
+	require.Equal(t, "replica0", cfg.Slaves[0].Host)
+	require.Nil(t, cfg.Slaves[0].TLS)
+	require.Equal(t, "replica1.prod", cfg.Slaves[1].Host)
+	require.Equal(t, 2, len(cfg.Slaves))
+	require.Equal(t, 300, cfg.SlavePool.MaxOpenConns)
+	require.True(t, cfg.HealthCheck.Enabled)
+	require.Equal(t, 30*time.Second, cfg.HealthCheck.MaxLag)
+
+	env = map[string]string{"MYSQL_MASTER_PORT": "abc"}
+	_, err = applyEnv(reflect.ValueOf(&cfg).Elem(), "MYSQL", lookup)
+	require.ErrorContains(t, "MYSQL_MASTER_PORT", err)
+
+	t.Setenv("TEST_MYSQL_MASTER_DB_NAME", "photon")
+	require.NoError(t, cfg.ApplyEnv("TEST_MYSQL"))
+	require.Equal(t, "photon", cfg.Master.DBName)
+}
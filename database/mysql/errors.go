@@ -0,0 +1,121 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"net/http"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// MySQL server error numbers.
+const (
+	ErConCount        uint16 = 1040
+	ErDupEntry        uint16 = 1062
+	ErServerShutdown  uint16 = 1053
+	ErLockWaitTimeout uint16 = 1205
+	ErLockDeadlock    uint16 = 1213
+	ErNoReferenced    uint16 = 1216
+	ErRowIsReferenced uint16 = 1217
+	ErRowIsRefd2      uint16 = 1451
+	ErNoReferenced2   uint16 = 1452
+	ErDupEntryWithKey uint16 = 1586
+	ErConnKilled      uint16 = 1927
+)
+
+// errorNumber returns the MySQL server error number in err's chain.
+func errorNumber(err error) (uint16, bool) {
+	var mysqlErr *gomysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number, true
+	}
+	return 0, false
+}
+
+func isErrorNumber(err error, nums ...uint16) bool {
+	num, ok := errorNumber(err)
+	if !ok {
+		return false
+	}
+	for _, n := range nums {
+		if num == n {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDuplicateKey reports whether err is a unique key violation.
+func IsDuplicateKey(err error) bool {
+	return isErrorNumber(err, ErDupEntry, ErDupEntryWithKey)
+}
+
+// IsDeadlock reports whether err is a deadlock detected by InnoDB.
+// The transaction has been rolled back and may be retried.
+func IsDeadlock(err error) bool {
+	return isErrorNumber(err, ErLockDeadlock)
+}
+
+// IsLockTimeout reports whether err is a lock wait timeout.
+func IsLockTimeout(err error) bool {
+	return isErrorNumber(err, ErLockWaitTimeout)
+}
+
+// IsForeignKeyViolation reports whether err is a foreign key
+// constraint failure, either a missing parent row or a parent row
+// still referenced by children.
+func IsForeignKeyViolation(err error) bool {
+	return isErrorNumber(err,
+		ErNoReferenced,
+		ErRowIsReferenced,
+		ErRowIsRefd2,
+		ErNoReferenced2,
+	)
+}
+
+// IsConnectionError reports whether err indicates a broken or
+// refused connection rather than a failed statement.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if isErrorNumber(err, ErConCount, ErServerShutdown, ErConnKilled) {
+		return true
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, gomysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Context errors implement net.Error but are raised by the
+	// caller's deadline or cancellation, not by the connection.
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// MapHTTPError maps database errors to HTTP statuses. The response
+// code equals the status. It matches handler.ErrorMapper and can be
+// registered with handler.AddErrorMapper.
+func MapHTTPError(err error) (int, int, bool) {
+	status := 0
+	switch {
+	case IsDuplicateKey(err), IsForeignKeyViolation(err):
+		status = http.StatusConflict
+	case IsDeadlock(err), IsLockTimeout(err), IsConnectionError(err):
+		status = http.StatusServiceUnavailable
+	default:
+		return 0, 0, false
+	}
+	return status, status, true
+}
@@ -0,0 +1,68 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"net/http"
+	"testing"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func mysqlErr(num uint16) error {
+	return errors.Wrap(&gomysql.MySQLError{Number: num}, "exec")
+}
+
+func TestErrorPredicates(t *testing.T) {
+	require.True(t, IsDuplicateKey(mysqlErr(ErDupEntry)))
+	require.True(t, IsDuplicateKey(mysqlErr(ErDupEntryWithKey)))
+	require.False(t, IsDuplicateKey(mysqlErr(ErLockDeadlock)))
+	require.False(t, IsDuplicateKey(nil))
+
+	require.True(t, IsDeadlock(mysqlErr(ErLockDeadlock)))
+	require.True(t, IsLockTimeout(mysqlErr(ErLockWaitTimeout)))
+	require.True(t, IsForeignKeyViolation(mysqlErr(ErNoReferenced2)))
+	require.True(t, IsForeignKeyViolation(mysqlErr(ErRowIsRefd2)))
+
+	require.True(t, IsConnectionError(errors.Wrap(driver.ErrBadConn, "q")))
+	require.True(t, IsConnectionError(gomysql.ErrInvalidConn))
+	require.True(t, IsConnectionError(&net.OpError{Op: "dial"}))
+	require.True(t, IsConnectionError(mysqlErr(ErConCount)))
+	require.False(t, IsConnectionError(mysqlErr(ErDupEntry)))
+	require.False(t, IsConnectionError(errors.New("boom")))
+	require.False(t, IsConnectionError(
+		errors.Wrap(context.DeadlineExceeded, "query")))
+	require.False(t, IsConnectionError(context.Canceled))
+	require.False(t, IsConnectionError(nil))
+}
+
+func TestMapHTTPError(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		status int
+	}{
+		{mysqlErr(ErDupEntry), http.StatusConflict},
+		{mysqlErr(ErNoReferenced2), http.StatusConflict},
+		{mysqlErr(ErLockDeadlock), http.StatusServiceUnavailable},
+		{driver.ErrBadConn, http.StatusServiceUnavailable},
+	} {
+		status, code, ok := MapHTTPError(c.err)
+		require.True(t, ok)
+		require.Equal(t, c.status, status)
+		require.Equal(t, c.status, code)
+	}
+
+	for _, err := range []error{
+		errors.New("boom"),
+		errors.Wrap(context.DeadlineExceeded, "query"),
+		gorm.ErrRecordNotFound,
+	} {
+		_, _, ok := MapHTTPError(err)
+		require.False(t, ok)
+	}
+}
@@ -0,0 +1,274 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/photon-storage/go-common/log"
+	"github.com/photon-storage/go-common/metrics"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultFailureThreshold    = 2
+)
+
+var (
+	ErrReplicationStopped = errors.New("replication is not running")
+)
+
+// HealthCheckConfig defines replica health checking.
+type HealthCheckConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval between checks. Defaults to 5s.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout of a single check. Defaults to 2s.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxLag ejects replicas lagging behind the master by more than
+	// the given duration. Zero disables the lag check.
+	MaxLag time.Duration `yaml:"max_lag"`
+	// FailureThreshold is the number of consecutive failed checks
+	// before a replica is ejected. Defaults to 2. A single successful
+	// check brings it back.
+	FailureThreshold int `yaml:"failure_threshold"`
+}
+
+func (c HealthCheckConfig) withDefaults() HealthCheckConfig {
+	if c.Interval == 0 {
+		c.Interval = defaultHealthCheckInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultHealthCheckTimeout
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	return c
+}
+
+type replica struct {
+	node     string
+	db       *sql.DB
+	healthy  bool
+	failures int
+}
+
+// HealthCheckPolicy is a dbresolver policy routing reads to healthy
+// replicas only. Replicas are pinged periodically and ejected when
+// unreachable or lagging. Reads fall back to the master when no
+// replica is healthy.
+type HealthCheckPolicy struct {
+	cfg    HealthCheckConfig
+	master gorm.ConnPool
+	policy dbresolver.Policy
+
+	mu       sync.RWMutex
+	replicas []*replica
+	healthy  []gorm.ConnPool
+}
+
+// NewHealthCheckPolicy creates a health checking policy. The inner
+// policy selects among healthy replicas.
+func NewHealthCheckPolicy(
+	cfg HealthCheckConfig,
+	master gorm.ConnPool,
+	policy dbresolver.Policy,
+) *HealthCheckPolicy {
+	return &HealthCheckPolicy{
+		cfg:    cfg.withDefaults(),
+		master: master,
+		policy: policy,
+	}
+}
+
+// AddReplica registers a replica to be checked. Replicas start
+// healthy until the first check says otherwise.
+func (p *HealthCheckPolicy) AddReplica(
+	node string,
+	db *sql.DB,
+) *HealthCheckPolicy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.replicas = append(p.replicas, &replica{
+		node:    node,
+		db:      db,
+		healthy: true,
+	})
+	p.healthy = append(p.healthy, db)
+
+	lbl := "node#" + node
+	metrics.NewGauge("mysql_replica_healthy." + lbl)
+	metrics.NewGauge("mysql_replica_lag_seconds." + lbl)
+	metrics.NewCounter("mysql_replica_ejections_total." + lbl)
+	metrics.GaugeSet("mysql_replica_healthy."+lbl, 1)
+
+	return p
+}
+
+// Resolve implements dbresolver.Policy. The given pools are ignored
+// in favor of the currently healthy replicas.
+func (p *HealthCheckPolicy) Resolve(_ []gorm.ConnPool) gorm.ConnPool {
+	p.mu.RLock()
+	healthy := p.healthy
+	p.mu.RUnlock()
+
+	switch len(healthy) {
+	case 0:
+		return p.master
+	case 1:
+		return healthy[0]
+	default:
+		return p.policy.Resolve(healthy)
+	}
+}
+
+// Run checks replicas every interval until ctx is done.
+func (p *HealthCheckPolicy) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *HealthCheckPolicy) checkAll(ctx context.Context) {
+	p.mu.RLock()
+	replicas := p.replicas
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(replicas))
+	for i, r := range replicas {
+		wg.Add(1)
+		go func(i int, r *replica) {
+			defer wg.Done()
+			errs[i] = p.check(ctx, r)
+		}(i, r)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy []gorm.ConnPool
+	for i, r := range replicas {
+		p.update(r, errs[i])
+		if r.healthy {
+			healthy = append(healthy, r.db)
+		}
+	}
+	if len(healthy) == 0 && len(p.healthy) > 0 {
+		log.Error("No healthy mysql replica, reading from master")
+	}
+	p.healthy = healthy
+}
+
+func (p *HealthCheckPolicy) update(r *replica, err error) {
+	lbl := "node#" + r.node
+	if err == nil {
+		r.failures = 0
+		if !r.healthy {
+			r.healthy = true
+			metrics.GaugeSet("mysql_replica_healthy."+lbl, 1)
+			log.Info("MySQL replica recovered", "node", r.node)
+		}
+		return
+	}
+
+	r.failures++
+	if r.healthy && r.failures >= p.cfg.FailureThreshold {
+		r.healthy = false
+		metrics.GaugeSet("mysql_replica_healthy."+lbl, 0)
+		metrics.CounterInc("mysql_replica_ejections_total." + lbl)
+		log.Warn("MySQL replica ejected",
+			"node", r.node,
+			"failures", r.failures,
+			"error", err,
+		)
+	}
+}
+
+func (p *HealthCheckPolicy) check(ctx context.Context, r *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	if err := r.db.PingContext(ctx); err != nil {
+		return errors.Wrap(err, "ping")
+	}
+
+	if p.cfg.MaxLag <= 0 {
+		return nil
+	}
+
+	lag, err := replicationLag(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	metrics.GaugeSet("mysql_replica_lag_seconds.node#"+r.node, lag.Seconds())
+	if lag > p.cfg.MaxLag {
+		return errors.Errorf("replication lag %v exceeds %v", lag, p.cfg.MaxLag)
+	}
+	return nil
+}
+
+// replicationLag reads Seconds_Behind_Master from SHOW SLAVE STATUS.
+// A server that is not a replica reports no lag.
+func replicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, errors.Wrap(err, "show slave status")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	vals := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return 0, err
+	}
+
+	for i, col := range cols {
+		if col != "Seconds_Behind_Master" {
+			continue
+		}
+		if !vals[i].Valid {
+			return 0, ErrReplicationStopped
+		}
+
+		secs, err := strconv.ParseInt(vals[i].String, 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(err, "parse Seconds_Behind_Master")
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func unreachableDB(t *testing.T) *sql.DB {
+	dsnCfg, err := Conn{Host: "127.0.0.1", Port: 1}.DSNConfig()
+	require.NoError(t, err)
+	db := sql.OpenDB(newConnector(dsnCfg, StaticSecret("")))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestHealthCheckPolicyFailover(t *testing.T) {
+	master := unreachableDB(t)
+	slave0 := unreachableDB(t)
+	slave1 := unreachableDB(t)
+
+	p := NewHealthCheckPolicy(
+		HealthCheckConfig{Enabled: true, FailureThreshold: 2},
+		master,
+		dbresolver.RandomPolicy{},
+	)
+	p.AddReplica("test_slave0", slave0).AddReplica("test_slave1", slave1)
+
+	pools := []gorm.ConnPool{slave0, slave1, master}
+	for i := 0; i < 10; i++ {
+		require.NotEqual(t, gorm.ConnPool(master), p.Resolve(pools))
+	}
+
+	// One failure is below the threshold.
+	p.checkAll(context.Background())
+	require.Equal(t, 2, len(p.healthy))
+
+	p.checkAll(context.Background())
+	require.Equal(t, 0, len(p.healthy))
+	require.Equal(t, gorm.ConnPool(master), p.Resolve(pools))
+}
+
+func TestHealthCheckPolicyUpdate(t *testing.T) {
+	p := NewHealthCheckPolicy(HealthCheckConfig{}, nil, nil)
+	r := &replica{node: "test_update", healthy: true}
+
+	p.update(r, errors.New("down"))
+	require.True(t, r.healthy)
+	p.update(r, errors.New("down"))
+	require.False(t, r.healthy)
+	require.Equal(t, 2, r.failures)
+
+	p.update(r, nil)
+	require.True(t, r.healthy)
+	require.Equal(t, 0, r.failures)
+}
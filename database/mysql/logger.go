@@ -0,0 +1,154 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+
+	"github.com/photon-storage/go-common/log"
+)
+
+const defaultSlowThreshold = 200 * time.Millisecond
+
+var (
+	redactStringRe = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"`)
+	redactNumberRe = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID. Queries
+// issued with the context, e.g. through db.WithContext(ctx), log the
+// ID along with the statement.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Logger is a gorm logger writing through the log package.
+type Logger struct {
+	level         logger.LogLevel
+	slowThreshold time.Duration
+	redactParams  bool
+}
+
+var _ logger.Interface = (*Logger)(nil)
+
+// NewLogger creates a gorm logger. Queries slower than slowThreshold
+// are logged as warnings. If redactParams is set, literal values are
+// replaced by '?' in logged statements.
+func NewLogger(
+	level logger.LogLevel,
+	slowThreshold time.Duration,
+	redactParams bool,
+) *Logger {
+	return &Logger{
+		level:         level,
+		slowThreshold: slowThreshold,
+		redactParams:  redactParams,
+	}
+}
+
+func (l *Logger) LogMode(level logger.LogLevel) logger.Interface {
+	nl := *l
+	nl.level = level
+	return &nl
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		log.FromContext(ctx).Info(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		log.FromContext(ctx).Warn(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		log.FromContext(ctx).Error(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *Logger) Trace(
+	ctx context.Context,
+	begin time.Time,
+	fc func() (string, int64),
+	err error,
+) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil &&
+		l.level >= logger.Error &&
+		!errors.Is(err, gorm.ErrRecordNotFound):
+		log.FromContext(ctx).Error("MySQL query failed",
+			append(l.traceFields(ctx, elapsed, fc), "error", err)...,
+		)
+
+	case l.slowThreshold > 0 &&
+		elapsed > l.slowThreshold &&
+		l.level >= logger.Warn:
+		log.FromContext(ctx).Warn("MySQL slow query",
+			append(l.traceFields(ctx, elapsed, fc),
+				"slow_threshold", l.slowThreshold,
+			)...,
+		)
+
+	case l.level >= logger.Info:
+		log.FromContext(ctx).Info("MySQL query", l.traceFields(ctx, elapsed, fc)...)
+	}
+}
+
+func (l *Logger) fields(ctx context.Context) []interface{} {
+	fields := []interface{}{"caller", utils.FileWithLineNum()}
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, "request_id", id)
+	}
+	return fields
+}
+
+func (l *Logger) traceFields(
+	ctx context.Context,
+	elapsed time.Duration,
+	fc func() (string, int64),
+) []interface{} {
+	sql, rows := fc()
+	if l.redactParams {
+		sql = redactSQL(sql)
+	}
+
+	var rowsVal interface{} = rows
+	if rows == -1 {
+		rowsVal = "-"
+	}
+
+	return append(l.fields(ctx),
+		"sql", sql,
+		"rows", rowsVal,
+		"elapsed", elapsed,
+	)
+}
+
+// redactSQL replaces string and numeric literals with placeholders.
+func redactSQL(sql string) string {
+	sql = redactStringRe.ReplaceAllString(sql, "'?'")
+	return redactNumberRe.ReplaceAllString(sql, "?")
+}
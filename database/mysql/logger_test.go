@@ -0,0 +1,60 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/photon-storage/go-common/log"
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestLoggerTrace(t *testing.T) {
+	hook := log.TestingHook(t)
+	ctx := WithRequestID(context.Background(), "req-1")
+	fc := func() (string, int64) {
+		return "SELECT * FROM users WHERE name = 'bob' AND age > 30", 2
+	}
+
+	l := NewLogger(logger.Info, 100*time.Millisecond, true)
+	l.Trace(ctx, time.Now(), fc, nil)
+	e := hook.LastEntry()
+	require.NotNil(t, e)
+	require.Equal(t, logrus.InfoLevel, e.Level)
+	require.Equal(t, "MySQL query", e.Message)
+	require.Equal(t, "req-1", e.Data["request_id"])
+	require.Equal(t, int64(2), e.Data["rows"])
+	require.Equal(t,
+		"SELECT * FROM users WHERE name = '?' AND age > ?",
+		e.Data["sql"],
+	)
+
+	l.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	e = hook.LastEntry()
+	require.Equal(t, logrus.WarnLevel, e.Level)
+	require.Equal(t, "MySQL slow query", e.Message)
+
+	l.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	e = hook.LastEntry()
+	require.Equal(t, logrus.ErrorLevel, e.Level)
+	require.Equal(t, "MySQL query failed", e.Message)
+
+	hook.Reset()
+	l.LogMode(logger.Warn).Trace(ctx, time.Now(), fc, gorm.ErrRecordNotFound)
+	require.Equal(t, 0, len(hook.AllEntries()))
+
+	l.LogMode(logger.Silent).Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 0, len(hook.AllEntries()))
+}
+
+func TestRedactSQL(t *testing.T) {
+	require.Equal(t,
+		"INSERT INTO `t1` (`a`,`b`,`c`) VALUES ('?',?,'?')",
+		redactSQL("INSERT INTO `t1` (`a`,`b`,`c`) VALUES ('it''s',1.5,'x\\'y')"),
+	)
+}
@@ -0,0 +1,182 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/metrics"
+)
+
+const metricsStartKey = "metrics:start"
+
+var (
+	// poolsMu guards pools, which maps pool labels to the pool whose
+	// stats are exported under them.
+	poolsMu sync.Mutex
+	pools   = map[string]*sql.DB{}
+)
+
+type metricsPool struct {
+	database string
+	node     string
+	db       *sql.DB
+}
+
+// MetricsPlugin is a gorm plugin exporting connection pool stats and
+// per table and operation query latency and error counts through the
+// metrics package.
+type MetricsPlugin struct {
+	pools []metricsPool
+	// declared caches the collectors already declared so queries do
+	// not contend on the metrics package lock.
+	declared sync.Map
+}
+
+// NewMetricsPlugin creates a metrics plugin. Pools to export stats
+// for are added with AddPool before the plugin is used.
+func NewMetricsPlugin() *MetricsPlugin {
+	return &MetricsPlugin{}
+}
+
+// AddPool exports the stats of the given pool labeled by database and
+// node name. Adding a pool under the same labels again, e.g. when
+// reopening the database, exports the stats of the latest pool.
+func (p *MetricsPlugin) AddPool(
+	database string,
+	node string,
+	db *sql.DB,
+) *MetricsPlugin {
+	p.pools = append(p.pools, metricsPool{
+		database: database,
+		node:     node,
+		db:       db,
+	})
+	return p
+}
+
+func (p *MetricsPlugin) Name() string {
+	return "photon:metrics"
+}
+
+type callbackRegisterer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+func (p *MetricsPlugin) Initialize(db *gorm.DB) error {
+	for _, pool := range p.pools {
+		registerPoolMetrics(pool)
+	}
+
+	cb := db.Callback()
+	for _, c := range []struct {
+		op     string
+		before callbackRegisterer
+		after  callbackRegisterer
+	}{
+		{"create", cb.Create().Before("gorm:create"), cb.Create().After("gorm:create")},
+		{"query", cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")},
+		{"update", cb.Update().Before("gorm:update"), cb.Update().After("gorm:update")},
+		{"delete", cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete")},
+		{"row", cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")},
+		{"raw", cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")},
+	} {
+		if err := c.before.Register("metrics:before_"+c.op, p.before); err != nil {
+			return err
+		}
+		if err := c.after.Register("metrics:after_"+c.op, p.after(c.op)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *MetricsPlugin) before(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (p *MetricsPlugin) after(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+
+		lbl := fmt.Sprintf("table#%v.op#%v", tableLabel(db.Statement.Table), op)
+		name := "mysql_query_latency_ms." + lbl
+		p.declare(name, func() {
+			metrics.NewHistogram(name, metrics.ElapsedBucketsInMs...)
+		})
+		metrics.HistAdd(name, time.Since(start).Milliseconds())
+
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			name := "mysql_query_errors_total." + lbl
+			p.declare(name, func() {
+				metrics.NewCounter(name)
+			})
+			metrics.CounterInc(name)
+		}
+	}
+}
+
+// declare calls fn to declare the named collector unless this plugin
+// did already. The name is cached only once declared, so concurrent
+// first uses may declare it twice, which the metrics package ignores.
+func (p *MetricsPlugin) declare(name string, fn func()) {
+	if _, ok := p.declared.Load(name); ok {
+		return
+	}
+	fn()
+	p.declared.Store(name, true)
+}
+
+// tableLabel sanitizes the table name for use as a metric label.
+// The metrics package uses '.' and '#' as separators.
+func tableLabel(table string) string {
+	if table == "" {
+		return "unknown"
+	}
+	return strings.NewReplacer(".", "_", "#", "_").Replace(table)
+}
+
+func registerPoolMetrics(pool metricsPool) {
+	lbl := fmt.Sprintf("db#%v.node#%v", tableLabel(pool.database), pool.node)
+	poolsMu.Lock()
+	pools[lbl] = pool.db
+	poolsMu.Unlock()
+
+	stats := func() sql.DBStats {
+		poolsMu.Lock()
+		db := pools[lbl]
+		poolsMu.Unlock()
+		return db.Stats()
+	}
+	metrics.NewGaugeFunc("mysql_pool_max_open_connections."+lbl, func() float64 {
+		return float64(stats().MaxOpenConnections)
+	})
+	metrics.NewGaugeFunc("mysql_pool_open_connections."+lbl, func() float64 {
+		return float64(stats().OpenConnections)
+	})
+	metrics.NewGaugeFunc("mysql_pool_in_use_connections."+lbl, func() float64 {
+		return float64(stats().InUse)
+	})
+	metrics.NewGaugeFunc("mysql_pool_idle_connections."+lbl, func() float64 {
+		return float64(stats().Idle)
+	})
+	metrics.NewCounterFunc("mysql_pool_wait_count_total."+lbl, func() float64 {
+		return float64(stats().WaitCount)
+	})
+	metrics.NewCounterFunc("mysql_pool_wait_duration_ms_total."+lbl, func() float64 {
+		return float64(stats().WaitDuration.Milliseconds())
+	})
+}
@@ -0,0 +1,151 @@
+package mysql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+type metricsTestRow struct {
+	ID   uint64
+	Name string
+}
+
+func TestMetricsPlugin(t *testing.T) {
+	dsnCfg, err := Conn{Host: "127.0.0.1", Port: 1}.DSNConfig()
+	require.NoError(t, err)
+	sqlDB := sql.OpenDB(newConnector(dsnCfg, StaticSecret("")))
+	defer sqlDB.Close()
+
+	db, err := gorm.Open(
+		mysql.New(mysql.Config{
+			Conn:                      sqlDB,
+			SkipInitializeWithVersion: true,
+		}),
+		&gorm.Config{
+			DryRun:                 true,
+			DisableAutomaticPing:   true,
+			SkipDefaultTransaction: true,
+		},
+	)
+	require.NoError(t, err)
+
+	p := NewMetricsPlugin().AddPool("app", "master", sqlDB)
+	require.NoError(t, db.Use(p))
+
+	var rows []metricsTestRow
+	require.NoError(t, db.Find(&rows).Error)
+	require.NoError(t, db.Create(&metricsTestRow{Name: "a"}).Error)
+
+	for _, c := range []struct {
+		name   string
+		labels map[string]string
+		ok     bool
+	}{
+		{"mysql_query_latency_ms", map[string]string{
+			"table": "metrics_test_rows", "op": "query"}, true},
+		{"mysql_query_latency_ms", map[string]string{
+			"table": "metrics_test_rows", "op": "create"}, true},
+		{"mysql_query_errors_total", map[string]string{
+			"table": "metrics_test_rows", "op": "query"}, false},
+		{"mysql_pool_max_open_connections", map[string]string{
+			"db": "app", "node": "master"}, true},
+	} {
+		_, ok := gatherMetric(t, c.name, c.labels)
+		require.Equal(t, c.ok, ok, c.name, c.labels)
+	}
+
+	_, ok := p.declared.Load(
+		"mysql_query_latency_ms.table#metrics_test_rows.op#query")
+	require.True(t, ok)
+}
+
+func TestMetricsPluginReopen(t *testing.T) {
+	open := func(maxOpen int) *sql.DB {
+		sqlDB := unreachableDB(t)
+		sqlDB.SetMaxOpenConns(maxOpen)
+		return sqlDB
+	}
+
+	labels := map[string]string{"db": "reopen", "node": "master"}
+	registerPoolMetrics(metricsPool{
+		database: "reopen",
+		node:     "master",
+		db:       open(3),
+	})
+	v, ok := gatherMetric(t, "mysql_pool_max_open_connections", labels)
+	require.True(t, ok)
+	require.Equal(t, float64(3), v)
+
+	// The latest pool registered under the same labels is exported.
+	registerPoolMetrics(metricsPool{
+		database: "reopen",
+		node:     "master",
+		db:       open(5),
+	})
+	v, _ = gatherMetric(t, "mysql_pool_max_open_connections", labels)
+	require.Equal(t, float64(5), v)
+
+	// Other databases are exported separately.
+	registerPoolMetrics(metricsPool{
+		database: "other",
+		node:     "master",
+		db:       open(7),
+	})
+	v, _ = gatherMetric(t, "mysql_pool_max_open_connections", labels)
+	require.Equal(t, float64(5), v)
+	v, _ = gatherMetric(t, "mysql_pool_max_open_connections",
+		map[string]string{"db": "other", "node": "master"})
+	require.Equal(t, float64(7), v)
+}
+
+// gatherMetric returns the value of the gauge or counter with the
+// given name and labels from the default registry. Histograms report
+// their sample count.
+func gatherMetric(
+	t *testing.T,
+	name string,
+	labels map[string]string,
+) (float64, bool) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range f.GetMetric() {
+			got := map[string]string{}
+			for _, l := range m.GetLabel() {
+				got[l.GetName()] = l.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue next
+				}
+			}
+
+			switch {
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue(), true
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue(), true
+			case m.GetHistogram() != nil:
+				return float64(m.GetHistogram().GetSampleCount()), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestTableLabel(t *testing.T) {
+	require.Equal(t, "unknown", tableLabel(""))
+	require.Equal(t, "db_table", tableLabel("db.table"))
+	require.Equal(t, "users", tableLabel("users"))
+}
@@ -0,0 +1,360 @@
+// Package migrate applies versioned SQL schema migrations to mysql.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/log"
+)
+
+const (
+	defaultTable       = "schema_migrations"
+	defaultLockName    = "schema_migrations"
+	defaultLockTimeout = time.Minute
+
+	errNoSuchTable = 1146
+)
+
+var (
+	ErrLockTimeout        = errors.New("timeout acquiring migration lock")
+	ErrLockTimeoutInvalid = errors.New("invalid migration lock timeout")
+	ErrChecksumMismatch   = errors.New("applied migration checksum mismatch")
+	ErrUnknownVersion     = errors.New("applied migration missing from source")
+	ErrNoDownScript       = errors.New("migration has no down script")
+)
+
+// Config defines migration settings.
+type Config struct {
+	// Table records applied migrations. Defaults to schema_migrations.
+	Table string `yaml:"table"`
+	// LockName is the GET_LOCK name serializing migrations across
+	// instances. Defaults to schema_migrations.
+	LockName string `yaml:"lock_name"`
+	// LockTimeout bounds the wait for the lock, rounded up to whole
+	// seconds. Defaults to 1m; negative values are rejected.
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+	// DryRun logs the statements to run without executing them.
+	DryRun bool `yaml:"dry_run"`
+	// AllowUnknown tolerates applied versions missing from the source,
+	// e.g. while rolling back a deployment.
+	AllowUnknown bool `yaml:"allow_unknown"`
+}
+
+// Migrator applies migrations from a source.
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+	cfg        Config
+}
+
+type applied struct {
+	version  uint64
+	checksum string
+}
+
+// New creates a migrator reading migrations from src.
+func New(db *gorm.DB, src fs.FS, cfg Config) (*Migrator, error) {
+	if cfg.LockTimeout < 0 {
+		return nil, errors.Wrap(ErrLockTimeoutInvalid, cfg.LockTimeout.String())
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := Load(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = defaultTable
+	}
+	if cfg.LockName == "" {
+		cfg.LockName = defaultLockName
+	}
+	if cfg.LockTimeout == 0 {
+		cfg.LockTimeout = defaultLockTimeout
+	}
+
+	return &Migrator{
+		db:         sqlDB,
+		migrations: migrations,
+		cfg:        cfg,
+	}, nil
+}
+
+// Run applies all pending migrations from src. It is meant to be
+// called at startup right after mysql.NewMySQLDB.
+func Run(ctx context.Context, db *gorm.DB, src fs.FS, cfg Config) error {
+	m, err := New(db, src, cfg)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+// Up applies all pending migrations in version order and returns the
+// number applied. Checksums of applied migrations are verified first.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+
+			if err := m.exec(ctx, conn, mig, mig.Up); err != nil {
+				return err
+			}
+			if err := m.record(ctx, conn, mig); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down rolls back up to steps most recently applied migrations and
+// returns the number rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return errors.Wrapf(ErrNoDownScript, "%d_%s",
+					mig.Version, mig.Name)
+			}
+
+			if err := m.exec(ctx, conn, mig, mig.Down); err != nil {
+				return err
+			}
+			if err := m.unrecord(ctx, conn, mig); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Verify checks applied migrations against the source.
+func (m *Migrator) Verify(ctx context.Context) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = m.prepare(ctx, conn)
+	return err
+}
+
+func (m *Migrator) withLock(
+	ctx context.Context,
+	fn func(conn *sql.Conn) error,
+) error {
+	// Advisory locks are bound to the session, so everything runs on
+	// a single connection.
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "get connection")
+	}
+	defer conn.Close()
+
+	var ok sql.NullInt64
+	if err := conn.QueryRowContext(ctx,
+		"SELECT GET_LOCK(?, ?)",
+		m.cfg.LockName,
+		lockSeconds(m.cfg.LockTimeout),
+	).Scan(&ok); err != nil {
+		return errors.Wrap(err, "get migration lock")
+	}
+	if ok.Int64 != 1 {
+		return errors.Wrap(ErrLockTimeout, m.cfg.LockName)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(
+			context.Background(),
+			"SELECT RELEASE_LOCK(?)",
+			m.cfg.LockName,
+		); err != nil {
+			log.Error("Failed to release migration lock", "error", err)
+		}
+	}()
+
+	return fn(conn)
+}
+
+// lockSeconds rounds the lock timeout up to whole seconds for
+// GET_LOCK, where 0 fails immediately and negative waits forever.
+func lockSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// prepare creates the schema table and returns verified applied
+// migrations keyed by version.
+func (m *Migrator) prepare(
+	ctx context.Context,
+	conn *sql.Conn,
+) (map[uint64]applied, error) {
+	if !m.cfg.DryRun {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS `%s` ("+
+				"`version` BIGINT UNSIGNED NOT NULL PRIMARY KEY, "+
+				"`name` VARCHAR(255) NOT NULL, "+
+				"`checksum` CHAR(64) NOT NULL, "+
+				"`applied_at` DATETIME NOT NULL"+
+				")",
+			m.cfg.Table,
+		)); err != nil {
+			return nil, errors.Wrap(err, "create schema table")
+		}
+	}
+
+	done, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[uint64]*Migration{}
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for version, a := range done {
+		mig := known[version]
+		if mig == nil {
+			if m.cfg.AllowUnknown {
+				log.Warn("Applied migration missing from source",
+					"version", version,
+				)
+				continue
+			}
+			return nil, errors.Wrapf(ErrUnknownVersion, "%d", version)
+		}
+		if mig.Checksum() != a.checksum {
+			return nil, errors.Wrapf(ErrChecksumMismatch, "%d_%s",
+				mig.Version, mig.Name)
+		}
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) applied(
+	ctx context.Context,
+	conn *sql.Conn,
+) (map[uint64]applied, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(
+		"SELECT `version`, `checksum` FROM `%s`",
+		m.cfg.Table,
+	))
+	if err != nil {
+		var mysqlErr *gomysql.MySQLError
+		if m.cfg.DryRun &&
+			errors.As(err, &mysqlErr) &&
+			mysqlErr.Number == errNoSuchTable {
+			return map[uint64]applied{}, nil
+		}
+		return nil, errors.Wrap(err, "read schema table")
+	}
+	defer rows.Close()
+
+	done := map[uint64]applied{}
+	for rows.Next() {
+		var a applied
+		if err := rows.Scan(&a.version, &a.checksum); err != nil {
+			return nil, err
+		}
+		done[a.version] = a
+	}
+	return done, rows.Err()
+}
+
+func (m *Migrator) exec(
+	ctx context.Context,
+	conn *sql.Conn,
+	mig *Migration,
+	script string,
+) error {
+	log.Info("Applying migration",
+		"version", mig.Version,
+		"name", mig.Name,
+		"dry_run", m.cfg.DryRun,
+	)
+
+	for _, stmt := range splitStatements(script) {
+		if m.cfg.DryRun {
+			log.Info("Dry run migration statement",
+				"version", mig.Version,
+				"sql", stmt,
+			)
+			continue
+		}
+
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "migration %d_%s", mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) record(
+	ctx context.Context,
+	conn *sql.Conn,
+	mig *Migration,
+) error {
+	if m.cfg.DryRun {
+		return nil
+	}
+
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO `%s` (`version`, `name`, `checksum`, `applied_at`) "+
+			"VALUES (?, ?, ?, ?)",
+		m.cfg.Table,
+	), mig.Version, mig.Name, mig.Checksum(), time.Now().UTC())
+	return errors.Wrap(err, "record migration")
+}
+
+func (m *Migrator) unrecord(
+	ctx context.Context,
+	conn *sql.Conn,
+	mig *Migration,
+) error {
+	if m.cfg.DryRun {
+		return nil
+	}
+
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM `%s` WHERE `version` = ?",
+		m.cfg.Table,
+	), mig.Version)
+	return errors.Wrap(err, "unrecord migration")
+}
@@ -0,0 +1,151 @@
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	gomysql "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+var testSource = fstest.MapFS{
+	"0001_create_table.up.sql": {Data: []byte("CREATE TABLE t (a INT);")},
+	"0002_add_index.up.sql":    {Data: []byte("CREATE INDEX i ON t (a);")},
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(
+		mysql.New(mysql.Config{
+			Conn:                      sqlDB,
+			SkipInitializeWithVersion: true,
+		}),
+		&gorm.Config{DisableAutomaticPing: true},
+	)
+	require.NoError(t, err)
+	return db, mock
+}
+
+func newMockMigrator(t *testing.T, cfg Config) (*Migrator, sqlmock.Sqlmock) {
+	db, mock := newMockDB(t)
+	m, err := New(db, testSource, cfg)
+	require.NoError(t, err)
+	return m, mock
+}
+
+func expectLock(mock sqlmock.Sqlmock, seconds int, acquired int) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).
+		WithArgs("schema_migrations", seconds).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(acquired))
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT RELEASE_LOCK(?)")).
+		WithArgs("schema_migrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func appliedRows(migrations ...*Migration) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"version", "checksum"})
+	for _, m := range migrations {
+		rows.AddRow(m.Version, m.Checksum())
+	}
+	return rows
+}
+
+func TestMigratorUp(t *testing.T) {
+	m, mock := newMockMigrator(t, Config{})
+
+	expectLock(mock, 60, 1)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_migrations`").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT `version`, `checksum` FROM `schema_migrations`")).
+		WillReturnRows(appliedRows(m.migrations[0]))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX i ON t (a)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `schema_migrations`")).
+		WithArgs(2, "add_index", m.migrations[1].Checksum(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(mock)
+
+	n, err := m.Up(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorLockTimeout(t *testing.T) {
+	m, mock := newMockMigrator(t, Config{LockTimeout: time.Minute})
+
+	// Nothing runs without the lock, and it is not released.
+	expectLock(mock, 60, 0)
+
+	n, err := m.Up(context.Background())
+	require.ErrorIs(t, ErrLockTimeout, err)
+	require.Equal(t, 0, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorLockTimeoutRounding(t *testing.T) {
+	// Sub-second timeouts wait at least a second.
+	m, mock := newMockMigrator(t, Config{LockTimeout: 100 * time.Millisecond})
+	expectLock(mock, 1, 0)
+	_, err := m.Up(context.Background())
+	require.ErrorIs(t, ErrLockTimeout, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, 2, lockSeconds(1500*time.Millisecond))
+	require.Equal(t, 60, lockSeconds(time.Minute))
+
+	db, _ := newMockDB(t)
+	_, err = New(db, testSource, Config{LockTimeout: -time.Second})
+	require.ErrorIs(t, ErrLockTimeoutInvalid, err)
+}
+
+func TestMigratorChecksumMismatch(t *testing.T) {
+	m, mock := newMockMigrator(t, Config{})
+
+	expectLock(mock, 60, 1)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT `version`, `checksum`").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).
+			AddRow(1, "edited"))
+	expectUnlock(mock)
+
+	n, err := m.Up(context.Background())
+	require.ErrorIs(t, ErrChecksumMismatch, err)
+	require.ErrorContains(t, "1_create_table", err)
+	require.Equal(t, 0, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	m, mock := newMockMigrator(t, Config{DryRun: true})
+
+	// The schema table is neither created nor written, and no
+	// migration statement is executed.
+	expectLock(mock, 60, 1)
+	mock.ExpectQuery("SELECT `version`, `checksum`").
+		WillReturnError(&gomysql.MySQLError{
+			Number:  errNoSuchTable,
+			Message: "Table 'schema_migrations' doesn't exist",
+		})
+	expectUnlock(mock)
+
+	n, err := m.Up(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
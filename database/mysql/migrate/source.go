@@ -0,0 +1,167 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	ErrMissingUp        = errors.New("migration has no up script")
+
+	fileNameRe = regexp.MustCompile(`^(\d+)_([\w-]+)\.(up|down)\.sql$`)
+)
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum is the hex encoded SHA-256 of the up script. It is recorded
+// when the migration is applied to detect later edits.
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load reads migrations from the root of src, ordered by version.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+// Down scripts are optional. Use an embed.FS or os.DirFS as source.
+func Load(src fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(src, ".")
+	if err != nil {
+		return nil, errors.Wrap(err, "read migration dir")
+	}
+
+	byVersion := map[uint64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		parts := fileNameRe.FindStringSubmatch(e.Name())
+		if parts == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse version of %s", e.Name())
+		}
+
+		content, err := fs.ReadFile(src, e.Name())
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", e.Name())
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{
+				Version: version,
+				Name:    parts[2],
+			}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, errors.Wrapf(ErrDuplicateVersion, "%d", version)
+		}
+
+		if parts[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, errors.Wrapf(ErrMissingUp, "%d_%s", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// splitStatements splits a script into statements on ';', ignoring
+// separators inside quotes and comments. Comments are removed, except
+// MySQL executable comments (/*! ... */) and optimizer hints
+// (/*+ ... */), which are kept as part of the statement. Empty
+// statements are dropped.
+func splitStatements(script string) []string {
+	var (
+		stmts []string
+		cur   strings.Builder
+		quote byte
+	)
+
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		cur.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			cur.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(script) {
+				i++
+				cur.WriteByte(script[i])
+			} else if c == quote {
+				quote = 0
+			}
+
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			cur.WriteByte(c)
+
+		case c == '-' && strings.HasPrefix(script[i:], "-- "),
+			c == '#':
+			// Line comment, skip to end of line.
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			cur.WriteByte('\n')
+
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script)
+			} else {
+				end += i + 4
+			}
+			if strings.HasPrefix(script[i:], "/*!") ||
+				strings.HasPrefix(script[i:], "/*+") {
+				cur.WriteString(script[i:end])
+			} else {
+				cur.WriteByte(' ')
+			}
+			i = end - 1
+
+		case c == ';':
+			flush()
+
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+
+	return stmts
+}
@@ -0,0 +1,72 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestLoad(t *testing.T) {
+	src := fstest.MapFS{
+		"0002_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t (a);")},
+		"0001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (a INT);")},
+		"0001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"README.md":                  {Data: []byte("ignored")},
+	}
+
+	migrations, err := Load(src)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(migrations))
+	require.Equal(t, uint64(1), migrations[0].Version)
+	require.Equal(t, "create_table", migrations[0].Name)
+	require.Equal(t, "DROP TABLE t;", migrations[0].Down)
+	require.Equal(t, uint64(2), migrations[1].Version)
+	require.Equal(t, "", migrations[1].Down)
+
+	require.Equal(t, 64, len(migrations[0].Checksum()))
+	require.NotEqual(t, migrations[0].Checksum(), migrations[1].Checksum())
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load(fstest.MapFS{
+		"0001_a.up.sql": {Data: []byte("SELECT 1")},
+		"0001_b.up.sql": {Data: []byte("SELECT 1")},
+	})
+	require.ErrorIs(t, ErrDuplicateVersion, err)
+
+	_, err = Load(fstest.MapFS{
+		"0001_a.down.sql": {Data: []byte("SELECT 1")},
+	})
+	require.ErrorIs(t, ErrMissingUp, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- create the table
+CREATE TABLE t (
+	a VARCHAR(16) DEFAULT 'x;y', # trailing comment;
+	b INT COMMENT "it\"s;"
+);
+/* block; comment */
+INSERT INTO t (a) VALUES ('it''s');
+
+;`
+	stmts := splitStatements(script)
+	require.Equal(t, 2, len(stmts))
+	require.Equal(t, "CREATE TABLE t (\n\ta VARCHAR(16) DEFAULT 'x;y', \n"+
+		"\tb INT COMMENT \"it\\\"s;\"\n)", stmts[0])
+	require.Equal(t, "INSERT INTO t (a) VALUES ('it''s')", stmts[1])
+}
+
+func TestSplitStatementsExecutableComments(t *testing.T) {
+	script := `
+CREATE TABLE t (a INT) /*!50100 PARTITION BY HASH (a); */ /* plain */;
+SELECT /*+ MAX_EXECUTION_TIME(1000) */ a FROM t;`
+	stmts := splitStatements(script)
+	require.Equal(t, 2, len(stmts))
+	require.Equal(t,
+		"CREATE TABLE t (a INT) /*!50100 PARTITION BY HASH (a); */", stmts[0])
+	require.Equal(t,
+		"SELECT /*+ MAX_EXECUTION_TIME(1000) */ a FROM t", stmts[1])
+}
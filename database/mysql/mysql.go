@@ -1,6 +1,8 @@
 package mysql
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -12,26 +14,152 @@ import (
 )
 
 // NewMySQLDB creates the mysql master/slaves cluster.
+// The config is validated and defaults are filled. It waits for all
+// nodes to become reachable as configured in cfg.Startup. Background
+// work such as replica health checking runs for the lifetime of the
+// process; use NewMySQLDBContext to bound it.
 func NewMySQLDB(cfg Config) (*gorm.DB, error) {
-	dsnTemplate := "%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=UTC"
-	masterDSN := fmt.Sprintf(dsnTemplate,
-		cfg.Master.Username,
-		cfg.Master.Password,
-		cfg.Master.Host,
-		cfg.Master.Port,
-		cfg.Master.DBName,
-	)
+	return NewMySQLDBContext(context.Background(), cfg)
+}
+
+// NewMySQLDBContext is like NewMySQLDB. Waiting for the nodes is
+// aborted and background work stops when ctx is done.
+func NewMySQLDBContext(ctx context.Context, cfg Config) (*gorm.DB, error) {
+	c, err := newCluster("", cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := waitReady(ctx, c.nodes, c.cfg.Startup); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	db, err := c.open(ctx, nil)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// cluster holds the connection pools of a master/slaves cluster
+// before it is opened.
+type cluster struct {
+	cfg      Config
+	master   gorm.Dialector
+	replicas []gorm.Dialector
+	policy   dbresolver.Policy
+	health   *HealthCheckPolicy
+	metrics  *MetricsPlugin
+	nodes    []node
+}
+
+// tableRoute routes the listed tables to another cluster.
+type tableRoute struct {
+	cluster *cluster
+	tables  []string
+}
 
+// newCluster validates the config and creates connection pools for
+// all nodes. Node names are prefixed with the cluster name, if any,
+// in metrics and logs.
+func newCluster(name string, cfg Config) (*cluster, error) {
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	nodeName := func(n string) string {
+		if name == "" {
+			return n
+		}
+		return name + "/" + n
+	}
+
+	c := &cluster{
+		cfg:     cfg,
+		metrics: NewMetricsPlugin(),
+	}
+
+	master, masterDB, err := newDialector(cfg.Master, cfg.masterPool())
+	if err != nil {
+		return nil, errors.Wrap(err, "build master dsn")
+	}
+	c.master = master
+	c.metrics.AddPool(cfg.Master.DBName, nodeName("master"), masterDB)
+	c.nodes = append(c.nodes, node{
+		name: nodeName("master"),
+		addr: cfg.Master.addr(),
+		db:   masterDB,
+	})
+
+	weights := map[gorm.ConnPool]int{}
+	for i, slave := range cfg.Slaves {
+		d, slaveDB, err := newDialector(slave, cfg.slavePool())
+		if err != nil {
+			c.close()
+			return nil, errors.Wrap(err, "build slave dsn")
+		}
+		n := nodeName(fmt.Sprintf("slave%d", i))
+		c.replicas = append(c.replicas, d)
+		weights[slaveDB] = slave.Weight
+		c.metrics.AddPool(slave.DBName, n, slaveDB)
+		c.nodes = append(c.nodes, node{
+			name: n,
+			addr: slave.addr(),
+			db:   slaveDB,
+		})
+	}
+
+	c.policy, err = newPolicy(cfg.Policy, weights)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	if cfg.HealthCheck.Enabled && len(cfg.Slaves) > 0 {
+		c.health = NewHealthCheckPolicy(cfg.HealthCheck, masterDB, c.policy)
+		for _, n := range c.nodes[1:] {
+			c.health.AddReplica(n.name, n.db)
+		}
+		c.policy = c.health
+
+		// dbresolver bypasses the policy for a single replica. Listing
+		// the master makes sure the policy is always consulted; it is
+		// only picked once all slaves are ejected.
+		c.replicas = append(c.replicas, master)
+	}
+
+	return c, nil
+}
+
+func (c *cluster) resolverConfig() dbresolver.Config {
+	return dbresolver.Config{
+		Sources:  []gorm.Dialector{c.master},
+		Replicas: c.replicas,
+		Policy:   c.policy,
+	}
+}
+
+// open creates the gorm DB of the cluster. Tables in routes are
+// served by their own clusters, sharing those clusters' pools.
+func (c *cluster) open(ctx context.Context, routes []tableRoute) (*gorm.DB, error) {
 	utc, err := time.LoadLocation("UTC")
 	if err != nil {
 		return nil, err
 	}
 
+	cfg := c.cfg
 	db, err := gorm.Open(
-		mysql.Open(masterDSN),
+		c.master,
 		&gorm.Config{
-			Logger:          logger.Default.LogMode(parseLoggerLevel(cfg.LogLevel)),
-			CreateBatchSize: 100,
+			Logger: NewLogger(
+				parseLoggerLevel(cfg.LogLevel),
+				cfg.slowThreshold(),
+				cfg.RedactParams,
+			),
+			CreateBatchSize: cfg.createBatchSize(),
 			NowFunc: func() time.Time {
 				return time.Now().In(utc)
 			},
@@ -41,35 +169,109 @@ func NewMySQLDB(cfg Config) (*gorm.DB, error) {
 		return nil, errors.Wrap(err, "open master mysql")
 	}
 
-	var slaveDSNs []gorm.Dialector
-	for _, slave := range cfg.Slaves {
-		slaveDSN := fmt.Sprintf(dsnTemplate,
-			slave.Username,
-			slave.Password,
-			slave.Host,
-			slave.Port,
-			slave.DBName,
-		)
-		slaveDSNs = append(slaveDSNs, mysql.Open(slaveDSN))
-	}
-
-	dbResolverCfg := dbresolver.Config{
-		Sources:  []gorm.Dialector{mysql.Open(masterDSN)},
-		Replicas: slaveDSNs,
-		Policy:   dbresolver.RandomPolicy{},
-	}
-	if err := db.Use(dbresolver.Register(dbResolverCfg).
-		SetConnMaxIdleTime(time.Hour).
-		SetConnMaxLifetime(24 * time.Hour).
-		SetMaxIdleConns(cfg.MaxIdleConns).
-		SetMaxOpenConns(cfg.MaxOpenConns),
-	); err != nil {
+	// Policies observing queries, e.g. EWMA latency, and metrics are
+	// also installed for the clusters whose tables are routed here.
+	metricsEnabled := cfg.Metrics
+	for _, rc := range append([]*cluster{c}, routedClusters(routes)...) {
+		if plugin, ok := rc.innerPolicy().(gorm.Plugin); ok {
+			if err := db.Use(plugin); err != nil {
+				return nil, err
+			}
+		}
+		metricsEnabled = metricsEnabled || rc.cfg.Metrics
+	}
+
+	resolver := dbresolver.Register(c.resolverConfig())
+	for _, r := range routes {
+		tables := make([]interface{}, len(r.tables))
+		for i, t := range r.tables {
+			tables[i] = t
+		}
+		resolver.Register(r.cluster.resolverConfig(), tables...)
+	}
+	if err := db.Use(resolver); err != nil {
 		return nil, err
 	}
 
+	if metricsEnabled {
+		plugin := c.metrics
+		if !cfg.Metrics {
+			// Query metrics of routed tables only.
+			plugin = NewMetricsPlugin()
+		}
+		if err := db.Use(plugin); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ReadYourWritesWindow > 0 {
+		if err := db.Use(
+			NewReadYourWritesPlugin(cfg.ReadYourWritesWindow),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.health != nil {
+		go c.health.Run(ctx)
+	}
+
 	return db, nil
 }
 
+// innerPolicy returns the replica policy without health checking.
+func (c *cluster) innerPolicy() dbresolver.Policy {
+	if c.health != nil {
+		return c.health.policy
+	}
+	return c.policy
+}
+
+func routedClusters(routes []tableRoute) []*cluster {
+	clusters := make([]*cluster, len(routes))
+	for i, r := range routes {
+		clusters[i] = r.cluster
+	}
+	return clusters
+}
+
+func (c *cluster) close() {
+	for _, n := range c.nodes {
+		n.db.Close()
+	}
+}
+
+// newDialector creates a dialector backed by its own connection pool.
+func newDialector(
+	c Conn,
+	pool PoolConfig,
+) (gorm.Dialector, *sql.DB, error) {
+	dsnCfg, err := c.DSNConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := c.passwordProvider()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sqlDB := sql.OpenDB(newConnector(dsnCfg, secret))
+	pool.apply(sqlDB)
+
+	return mysql.New(mysql.Config{
+		Conn:      sqlDB,
+		DSNConfig: dsnCfg,
+	}), sqlDB, nil
+}
+
+func (c Config) slowThreshold() time.Duration {
+	if c.SlowThreshold == 0 {
+		return defaultSlowThreshold
+	}
+	return c.SlowThreshold
+}
+
 func parseLoggerLevel(logStr string) logger.LogLevel {
 	switch logStr {
 	case "silent":
@@ -0,0 +1,103 @@
+// Package outbox implements the transactional outbox pattern on top of
+// mysql. Events are inserted in the same transaction as the business
+// writes and published asynchronously by a Relay.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	// TableName is the outbox table.
+	TableName = "outbox_events"
+	// DeadLetterTableName holds events that failed MaxAttempts times.
+	DeadLetterTableName = "outbox_dead_letters"
+
+	// Schema creates the outbox table. Include it in the service's
+	// migrations.
+	Schema = "CREATE TABLE IF NOT EXISTS `outbox_events` (\n" +
+		eventColumns +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx_event_key` (`event_key`, `id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+	// DeadLetterSchema creates the dead letter table. Include it in
+	// the service's migrations.
+	DeadLetterSchema = "CREATE TABLE IF NOT EXISTS `outbox_dead_letters` (\n" +
+		eventColumns +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+	eventColumns = "  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,\n" +
+		"  `topic` VARCHAR(255) NOT NULL,\n" +
+		"  `event_key` VARCHAR(255) NOT NULL DEFAULT '',\n" +
+		"  `payload` MEDIUMBLOB NOT NULL,\n" +
+		"  `attempts` INT NOT NULL DEFAULT 0,\n" +
+		"  `last_error` VARCHAR(1024) NOT NULL DEFAULT '',\n" +
+		"  `retry_at` DATETIME(6) NULL,\n" +
+		"  `created_at` DATETIME(6) NOT NULL,\n"
+
+	maxErrorLen = 1024
+)
+
+var (
+	ErrTopicEmpty = errors.New("event topic is empty")
+)
+
+// Event is a pending domain event in the outbox table.
+type Event struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+	// Topic names the event type, e.g. "deal.created".
+	Topic string `gorm:"type:varchar(255);not null"`
+	// Key identifies the entity the event is about. Events with the
+	// same key are published in insertion order, provided at most one
+	// relay runs per shard. See RelayConfig.Shards.
+	Key     string `gorm:"column:event_key;type:varchar(255);not null"`
+	Payload []byte `gorm:"type:mediumblob;not null"`
+	// Attempts and LastError record failed publish attempts. A failed
+	// event and later events with the same key are not retried before
+	// RetryAt.
+	Attempts  int        `gorm:"not null;default:0"`
+	LastError string     `gorm:"type:varchar(1024);not null"`
+	RetryAt   *time.Time `gorm:"type:datetime(6)"`
+	CreatedAt time.Time  `gorm:"not null"`
+}
+
+func (Event) TableName() string {
+	return TableName
+}
+
+// NewEvent creates an event with a JSON encoded payload.
+func NewEvent(topic string, key string, payload interface{}) (*Event, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal event payload")
+	}
+
+	return &Event{
+		Topic:   topic,
+		Key:     key,
+		Payload: b,
+	}, nil
+}
+
+// Insert adds events to the outbox. tx should be the caller's
+// transaction so the events are committed or rolled back together
+// with the business writes.
+func Insert(tx *gorm.DB, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	for _, e := range events {
+		if e.Topic == "" {
+			return ErrTopicEmpty
+		}
+	}
+
+	return errors.Wrap(tx.Create(events).Error, "insert outbox events")
+}
@@ -0,0 +1,215 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func dryRunDB(t *testing.T) *gorm.DB {
+	sqlDB, err := sql.Open("mysql", "root@tcp(127.0.0.1:1)/test")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestNewEvent(t *testing.T) {
+	e, err := NewEvent("deal.created", "deal-1", map[string]int{"size": 3})
+	require.NoError(t, err)
+	require.Equal(t, "deal.created", e.Topic)
+	require.Equal(t, "deal-1", e.Key)
+	require.Equal(t, `{"size":3}`, string(e.Payload))
+
+	_, err = NewEvent("deal.created", "deal-1", func() {})
+	require.NotNil(t, err)
+}
+
+func TestInsert(t *testing.T) {
+	db := dryRunDB(t)
+	require.NoError(t, Insert(db))
+	require.ErrorIs(t, ErrTopicEmpty, Insert(db, &Event{}))
+
+	e, err := NewEvent("deal.created", "deal-1", nil)
+	require.NoError(t, err)
+	tx := db.Session(&gorm.Session{})
+	require.NoError(t, Insert(tx, e))
+
+	stmt := tx.Create([]*Event{e}).Statement
+	require.Equal(t,
+		"INSERT INTO `outbox_events` "+
+			"(`topic`,`event_key`,`payload`,`attempts`,`last_error`,`retry_at`,`created_at`) "+
+			"VALUES (?,?,?,?,?,?,?)",
+		stmt.SQL.String(),
+	)
+}
+
+func TestProcessBatchError(t *testing.T) {
+	r, err := NewRelay(dryRunDB(t), PublisherFunc(
+		func(context.Context, *Event) error {
+			return nil
+		},
+	), RelayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, defaultBatchSize, r.cfg.BatchSize)
+	require.Equal(t, defaultPollInterval, r.cfg.PollInterval)
+	require.Equal(t, defaultMaxAttempts, r.cfg.MaxAttempts)
+
+	n, err := r.ProcessBatch(context.Background())
+	require.NotNil(t, err)
+	require.Equal(t, 0, n)
+}
+
+func mockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func eventRows(events ...*Event) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{
+		"id", "topic", "event_key", "payload",
+		"attempts", "last_error", "retry_at", "created_at",
+	})
+	for _, e := range events {
+		rows.AddRow(e.ID, e.Topic, e.Key, e.Payload,
+			e.Attempts, e.LastError, nil, time.Now())
+	}
+	return rows
+}
+
+// expectFailedBatch expects a batch of two events failing to publish.
+// The second one reaches MaxAttempts of 3.
+func expectFailedBatch(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(lockQuery+" ORDER BY e.id LIMIT ?")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+		WillReturnRows(eventRows(
+			&Event{ID: 1, Topic: "deal.created", Key: "a"},
+			&Event{ID: 2, Topic: "deal.created", Key: "b", Attempts: 2},
+		))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET")).
+		WithArgs(1, "broker down", sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_dead_letters`")).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `outbox_events` WHERE id = ?")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestProcessBatchAllFailed(t *testing.T) {
+	db, mock := mockDB(t)
+	expectFailedBatch(mock)
+	r, err := NewRelay(db, PublisherFunc(
+		func(context.Context, *Event) error {
+			return errors.New("broker down")
+		},
+	), RelayConfig{BatchSize: 2, MaxAttempts: 3})
+	require.NoError(t, err)
+
+	res, err := r.processBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, batchResult{locked: 2, failed: 2}, res)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunBacksOffAfterFailures(t *testing.T) {
+	db, mock := mockDB(t)
+	expectFailedBatch(mock)
+	expectFailedBatch(mock)
+
+	var published int32
+	r, err := NewRelay(db, PublisherFunc(
+		func(context.Context, *Event) error {
+			atomic.AddInt32(&published, 1)
+			return errors.New("broker down")
+		},
+	), RelayConfig{
+		BatchSize:    2,
+		PollInterval: time.Millisecond,
+		RetryBackoff: time.Hour,
+		MaxAttempts:  3,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	r.Run(ctx)
+
+	// The full but failed batch is not followed by another one.
+	require.Equal(t, int32(2), atomic.LoadInt32(&published))
+	require.NotNil(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBackoff(t *testing.T) {
+	r, err := NewRelay(dryRunDB(t), nil, RelayConfig{
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, time.Second, r.backoff(1))
+	require.Equal(t, 2*time.Second, r.backoff(2))
+	require.Equal(t, 4*time.Second, r.backoff(3))
+	require.Equal(t, 5*time.Second, r.backoff(4))
+	require.Equal(t, 5*time.Second, r.backoff(100))
+}
+
+func TestRelayShards(t *testing.T) {
+	db, mock := mockDB(t)
+	_, err := NewRelay(db, nil, RelayConfig{Shards: 4, Shard: 4})
+	require.ErrorIs(t, ErrShardInvalid, err)
+
+	r, err := NewRelay(db, nil, RelayConfig{Shards: 4, Shard: 1})
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(lockQuery+
+		" AND CRC32(e.event_key) % ? = ? ORDER BY e.id LIMIT ?")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 4, 1, defaultBatchSize).
+		WillReturnRows(eventRows())
+	mock.ExpectCommit()
+
+	n, err := r.ProcessBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTruncate(t *testing.T) {
+	require.Equal(t, "abc", truncate("abc", 3))
+	require.Equal(t, "ab", truncate("abc", 2))
+	// "é" and "世" are two and three bytes long.
+	require.Equal(t, "a", truncate("aé", 2))
+	require.Equal(t, "aé", truncate("aé世", 5))
+	require.Equal(t, "", truncate("世", 2))
+}
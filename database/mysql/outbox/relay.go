@@ -0,0 +1,320 @@
+package outbox
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/log"
+	"github.com/photon-storage/go-common/metrics"
+)
+
+const (
+	defaultBatchSize       = 100
+	defaultPollInterval    = time.Second
+	defaultRetryBackoff    = time.Second
+	defaultMaxRetryBackoff = time.Minute
+	defaultMaxAttempts     = 10
+
+	metricLag          = "outbox_lag_ms"
+	metricPublishLag   = "outbox_publish_lag_ms"
+	metricPublished    = "outbox_published_total"
+	metricPublishError = "outbox_publish_errors_total"
+	metricDeadLetters  = "outbox_dead_letters_total"
+
+	// lockQuery locks due events in id order, skipping events whose
+	// key has an earlier event waiting for a retry.
+	lockQuery = "SELECT * FROM `outbox_events` AS e " +
+		"WHERE (e.retry_at IS NULL OR e.retry_at <= ?) " +
+		"AND NOT EXISTS (SELECT 1 FROM `outbox_events` AS b " +
+		"WHERE b.event_key = e.event_key AND b.id < e.id AND b.retry_at > ?)"
+)
+
+var (
+	ErrShardInvalid = errors.New("invalid relay shard")
+)
+
+// Publisher delivers events to a message broker. Delivery is at least
+// once, so consumers must tolerate duplicates.
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface.
+type PublisherFunc func(ctx context.Context, e *Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, e *Event) error {
+	return f(ctx, e)
+}
+
+// RelayConfig defines relay settings.
+type RelayConfig struct {
+	// BatchSize is the maximum number of events locked and published
+	// per transaction. Defaults to 100.
+	BatchSize int `yaml:"batch_size"`
+	// PollInterval is the wait between polls once the outbox is
+	// drained or a poll failed. Defaults to 1s.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// RetryBackoff is the delay before a failed event is retried,
+	// doubled on every further attempt up to MaxRetryBackoff. The
+	// relay also backs off the same way after batches with failures.
+	// Default to 1s and 1m.
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	MaxRetryBackoff time.Duration `yaml:"max_retry_backoff"`
+	// MaxAttempts moves an event to the dead letter table once it
+	// failed that many times, unblocking later events with the same
+	// key. Defaults to 10. A negative value retries forever.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Shards splits the outbox by a hash of the event key among
+	// relays, each publishing the keys of its Shard in [0, Shards).
+	// Events with the same key are only published in order if at most
+	// one relay runs per shard. Zero or one means a single shard.
+	Shards int `yaml:"shards"`
+	Shard  int `yaml:"shard"`
+}
+
+// Relay publishes events from the outbox and deletes them once
+// published. Batches are locked with SELECT ... FOR UPDATE SKIP
+// LOCKED so concurrent relays never publish the same event at the
+// same time. To preserve per key ordering, run one relay per shard;
+// standby relays on the same shard may publish events of a key out
+// of order while another relay retries an earlier one.
+type Relay struct {
+	db  *gorm.DB
+	pub Publisher
+	cfg RelayConfig
+}
+
+// NewRelay creates a relay publishing events from db to pub.
+func NewRelay(db *gorm.DB, pub Publisher, cfg RelayConfig) (*Relay, error) {
+	if cfg.Shards > 1 && (cfg.Shard < 0 || cfg.Shard >= cfg.Shards) {
+		return nil, errors.Wrapf(ErrShardInvalid,
+			"shard %d of %d", cfg.Shard, cfg.Shards)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.MaxRetryBackoff <= 0 {
+		cfg.MaxRetryBackoff = defaultMaxRetryBackoff
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+
+	metrics.NewGauge(metricLag)
+	metrics.NewHistogram(metricPublishLag, metrics.ElapsedBucketsInMs...)
+	metrics.NewCounter(metricPublished)
+	metrics.NewCounter(metricPublishError)
+	metrics.NewCounter(metricDeadLetters)
+
+	return &Relay{
+		db:  db,
+		pub: pub,
+		cfg: cfg,
+	}, nil
+}
+
+// batchResult counts the events of a processed batch.
+type batchResult struct {
+	locked    int
+	published int
+	failed    int
+}
+
+// Run publishes events until ctx is done. Batches published in full
+// are followed by the next one right away. After a batch with
+// failures the relay backs off; otherwise it waits PollInterval.
+func (r *Relay) Run(ctx context.Context) {
+	failures := 0
+	for {
+		res, err := r.processBatch(ctx)
+		if err != nil {
+			log.Error("Error processing outbox batch", "error", err)
+		}
+
+		wait := r.cfg.PollInterval
+		switch {
+		case err != nil || res.failed > 0:
+			failures++
+			wait = r.backoff(failures)
+
+		case res.published == r.cfg.BatchSize:
+			failures = 0
+			continue
+
+		default:
+			failures = 0
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+
+		case <-t.C:
+		}
+	}
+}
+
+// backoff returns the delay after the given number of consecutive
+// failures.
+func (r *Relay) backoff(failures int) time.Duration {
+	d := r.cfg.RetryBackoff
+	for i := 1; i < failures && d < r.cfg.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > r.cfg.MaxRetryBackoff {
+		d = r.cfg.MaxRetryBackoff
+	}
+	return d
+}
+
+// ProcessBatch locks up to BatchSize due events in id order and
+// publishes them. Published events are deleted. A failed event is
+// kept with its attempt recorded and retried after a backoff, and
+// later events with the same key wait for it to preserve their
+// order. Events failing MaxAttempts times are moved to the dead
+// letter table. It returns the number of events published.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	res, err := r.processBatch(ctx)
+	return res.published, err
+}
+
+func (r *Relay) processBatch(ctx context.Context) (batchResult, error) {
+	var res batchResult
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res = batchResult{}
+		now := tx.NowFunc()
+
+		query := lockQuery
+		args := []interface{}{now, now}
+		if r.cfg.Shards > 1 {
+			query += " AND CRC32(e.event_key) % ? = ?"
+			args = append(args, r.cfg.Shards, r.cfg.Shard)
+		}
+		query += " ORDER BY e.id LIMIT ? FOR UPDATE SKIP LOCKED"
+		args = append(args, r.cfg.BatchSize)
+
+		var events []*Event
+		if err := tx.Raw(query, args...).Scan(&events).Error; err != nil {
+			return errors.Wrap(err, "lock outbox events")
+		}
+		res.locked = len(events)
+
+		if len(events) == 0 {
+			metrics.GaugeSet(metricLag, 0)
+			return nil
+		}
+		metrics.GaugeSet(metricLag, msSince(events[0].CreatedAt))
+
+		var published []uint64
+		failed := map[string]bool{}
+		for _, e := range events {
+			if failed[e.Key] {
+				continue
+			}
+
+			if err := r.pub.Publish(ctx, e); err != nil {
+				failed[e.Key] = true
+				res.failed++
+				metrics.CounterInc(metricPublishError)
+				log.Warn("Failed to publish outbox event",
+					"id", e.ID,
+					"topic", e.Topic,
+					"attempts", e.Attempts+1,
+					"error", err,
+				)
+
+				if err := r.recordFailure(tx, e, err, now); err != nil {
+					return err
+				}
+				continue
+			}
+
+			published = append(published, e.ID)
+			metrics.CounterInc(metricPublished)
+			metrics.HistAdd(metricPublishLag, msSince(e.CreatedAt))
+		}
+
+		res.published = len(published)
+		if len(published) == 0 {
+			return nil
+		}
+		return errors.Wrap(
+			tx.Where("id IN ?", published).Delete(&Event{}).Error,
+			"delete published outbox events",
+		)
+	})
+	if err != nil {
+		return batchResult{}, err
+	}
+
+	return res, nil
+}
+
+// recordFailure records a failed attempt and schedules the retry, or
+// moves the event to the dead letter table after MaxAttempts.
+func (r *Relay) recordFailure(
+	tx *gorm.DB,
+	e *Event,
+	publishErr error,
+	now time.Time,
+) error {
+	e.Attempts++
+	e.LastError = truncate(publishErr.Error(), maxErrorLen)
+
+	if r.cfg.MaxAttempts > 0 && e.Attempts >= r.cfg.MaxAttempts {
+		log.Error("Moving outbox event to dead letters",
+			"id", e.ID,
+			"topic", e.Topic,
+			"key", e.Key,
+			"attempts", e.Attempts,
+		)
+		metrics.CounterInc(metricDeadLetters)
+
+		e.RetryAt = nil
+		if err := tx.Table(DeadLetterTableName).Create(e).Error; err != nil {
+			return errors.Wrap(err, "insert outbox dead letter")
+		}
+		return errors.Wrap(
+			tx.Where("id = ?", e.ID).Delete(&Event{}).Error,
+			"delete outbox dead letter",
+		)
+	}
+
+	return errors.Wrap(
+		tx.Model(&Event{}).
+			Where("id = ?", e.ID).
+			Updates(map[string]interface{}{
+				"attempts":   e.Attempts,
+				"last_error": e.LastError,
+				"retry_at":   now.Add(r.backoff(e.Attempts)),
+			}).Error,
+		"record outbox failure",
+	)
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t) / time.Millisecond)
+}
+
+// truncate cuts s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,273 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	RandomPolicyName         = "random"
+	WeightedRandomPolicyName = "weighted_random"
+	RoundRobinPolicyName     = "round_robin"
+	LeastInFlightPolicyName  = "least_in_flight"
+	EWMALatencyPolicyName    = "ewma_latency"
+
+	// ewmaAlpha is the weight of the latest sample.
+	ewmaAlpha = 0.2
+	// ewmaErrorPenalty scales the highest average of the other pools
+	// into the sample recorded for a failed statement, which is at
+	// least ewmaMinErrorLatency.
+	ewmaErrorPenalty    = 10
+	ewmaMinErrorLatency = time.Second
+)
+
+var (
+	ErrPolicyInvalid = errors.New("invalid replica policy name")
+
+	// ewmaPolicies numbers EWMA policies so that several can be
+	// registered on the same DB.
+	ewmaPolicies uint64
+)
+
+// newPolicy creates the replica selection policy of the given name.
+// Weights are only used by the weighted random policy.
+func newPolicy(
+	name string,
+	weights map[gorm.ConnPool]int,
+) (dbresolver.Policy, error) {
+	switch name {
+	case "", RandomPolicyName:
+		return dbresolver.RandomPolicy{}, nil
+	case WeightedRandomPolicyName:
+		return NewWeightedRandomPolicy(weights), nil
+	case RoundRobinPolicyName:
+		return &RoundRobinPolicy{}, nil
+	case LeastInFlightPolicyName:
+		return LeastInFlightPolicy{}, nil
+	case EWMALatencyPolicyName:
+		return NewEWMALatencyPolicy(), nil
+	}
+
+	return nil, errors.Wrap(ErrPolicyInvalid, name)
+}
+
+// WeightedRandomPolicy picks pools randomly in proportion to their
+// weights. Pools without a positive weight get weight 1.
+type WeightedRandomPolicy struct {
+	weights map[gorm.ConnPool]int
+}
+
+func NewWeightedRandomPolicy(
+	weights map[gorm.ConnPool]int,
+) *WeightedRandomPolicy {
+	return &WeightedRandomPolicy{weights: weights}
+}
+
+func (p *WeightedRandomPolicy) weight(pool gorm.ConnPool) int {
+	if w := p.weights[pool]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+func (p *WeightedRandomPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	total := 0
+	for _, pool := range pools {
+		total += p.weight(pool)
+	}
+
+	n := rand.Intn(total)
+	for _, pool := range pools {
+		n -= p.weight(pool)
+		if n < 0 {
+			return pool
+		}
+	}
+	return pools[len(pools)-1]
+}
+
+// RoundRobinPolicy cycles through pools in order.
+type RoundRobinPolicy struct {
+	next uint64
+}
+
+func (p *RoundRobinPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	n := atomic.AddUint64(&p.next, 1) - 1
+	return pools[n%uint64(len(pools))]
+}
+
+// LeastInFlightPolicy picks the pool with fewer connections in use
+// out of two random choices. Pools that do not expose stats are
+// treated as idle.
+type LeastInFlightPolicy struct{}
+
+func (LeastInFlightPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	return pickTwo(pools, func(pool gorm.ConnPool) float64 {
+		if db, ok := pool.(*sql.DB); ok {
+			return float64(db.Stats().InUse)
+		}
+		return 0
+	})
+}
+
+// EWMALatencyPolicy picks the pool with the lower exponentially
+// weighted moving average of query latency out of two random choices.
+// It must also be registered as a gorm plugin to observe latencies.
+// Failed statements are recorded as a penalty sample so that a pool
+// failing fast is not preferred. Pools without samples score the
+// average of the sampled ones.
+type EWMALatencyPolicy struct {
+	// prefix names the plugin callbacks and instance keys.
+	prefix string
+
+	mu   sync.RWMutex
+	ewma map[gorm.ConnPool]float64
+}
+
+func NewEWMALatencyPolicy() *EWMALatencyPolicy {
+	return &EWMALatencyPolicy{
+		prefix: fmt.Sprintf("ewma%d", atomic.AddUint64(&ewmaPolicies, 1)),
+		ewma:   map[gorm.ConnPool]float64{},
+	}
+}
+
+func (p *EWMALatencyPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	sum, n := 0.0, 0
+	for _, pool := range pools {
+		if v, ok := p.ewma[pool]; ok {
+			sum += v
+			n++
+		}
+	}
+	neutral := 0.0
+	if n > 0 {
+		neutral = sum / float64(n)
+	}
+
+	return pickTwo(pools, func(pool gorm.ConnPool) float64 {
+		if v, ok := p.ewma[pool]; ok {
+			return v
+		}
+		return neutral
+	})
+}
+
+// Observe records a latency sample for the pool.
+func (p *EWMALatencyPolicy) Observe(pool gorm.ConnPool, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.observe(pool, float64(d))
+}
+
+// ObserveError records a penalty sample for a statement that failed
+// on the pool.
+func (p *EWMALatencyPolicy) ObserveError(pool gorm.ConnPool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	v := float64(ewmaMinErrorLatency)
+	for other, s := range p.ewma {
+		if other != pool && s*ewmaErrorPenalty > v {
+			v = s * ewmaErrorPenalty
+		}
+	}
+	p.observe(pool, v)
+}
+
+func (p *EWMALatencyPolicy) observe(pool gorm.ConnPool, v float64) {
+	if old, ok := p.ewma[pool]; ok {
+		v = ewmaAlpha*v + (1-ewmaAlpha)*old
+	}
+	p.ewma[pool] = v
+}
+
+func (p *EWMALatencyPolicy) Name() string {
+	return "photon:" + p.prefix + "_latency"
+}
+
+func (p *EWMALatencyPolicy) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, c := range []struct {
+		op     string
+		before callbackRegisterer
+		after  callbackRegisterer
+	}{
+		{"query", cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")},
+		{"row", cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")},
+		{"raw", cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")},
+	} {
+		if err := c.before.Register(p.prefix+":before_"+c.op, p.before); err != nil {
+			return err
+		}
+		if err := c.after.Register(p.prefix+":after_"+c.op, p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *EWMALatencyPolicy) before(db *gorm.DB) {
+	db.InstanceSet(p.prefix+":start", time.Now())
+}
+
+func (p *EWMALatencyPolicy) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(p.prefix + ":start")
+	if !ok {
+		return
+	}
+	start, ok := v.(time.Time)
+	if !ok {
+		return
+	}
+
+	pool := db.Statement.ConnPool
+	if stmtDB, ok := pool.(*gorm.PreparedStmtDB); ok {
+		pool = stmtDB.ConnPool
+	}
+	// Only track pools, not transactions or other per-call handles.
+	if _, ok := pool.(*sql.DB); !ok {
+		return
+	}
+
+	switch {
+	case db.Error == nil || errors.Is(db.Error, gorm.ErrRecordNotFound):
+		p.Observe(pool, time.Since(start))
+	case !errors.Is(db.Error, context.Canceled):
+		p.ObserveError(pool)
+	}
+}
+
+// pickTwo returns the pool with the lower score out of two distinct
+// random choices.
+func pickTwo(
+	pools []gorm.ConnPool,
+	score func(gorm.ConnPool) float64,
+) gorm.ConnPool {
+	if len(pools) == 1 {
+		return pools[0]
+	}
+
+	i := rand.Intn(len(pools))
+	j := rand.Intn(len(pools) - 1)
+	if j >= i {
+		j++
+	}
+
+	if score(pools[j]) < score(pools[i]) {
+		return pools[j]
+	}
+	return pools[i]
+}
@@ -0,0 +1,119 @@
+package mysql
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func testPools(n int) []gorm.ConnPool {
+	pools := make([]gorm.ConnPool, n)
+	for i := range pools {
+		pools[i] = &sql.DB{}
+	}
+	return pools
+}
+
+func TestNewPolicy(t *testing.T) {
+	p, err := newPolicy("", nil)
+	require.NoError(t, err)
+	require.Equal(t, dbresolver.RandomPolicy{}, p)
+
+	for _, name := range []string{
+		RandomPolicyName,
+		WeightedRandomPolicyName,
+		RoundRobinPolicyName,
+		LeastInFlightPolicyName,
+		EWMALatencyPolicyName,
+	} {
+		_, err := newPolicy(name, nil)
+		require.NoError(t, err)
+	}
+
+	_, err = newPolicy("fastest", nil)
+	require.ErrorIs(t, ErrPolicyInvalid, err)
+}
+
+func TestWeightedRandomPolicy(t *testing.T) {
+	pools := testPools(2)
+	p := NewWeightedRandomPolicy(map[gorm.ConnPool]int{
+		pools[0]: 9,
+	})
+
+	counts := map[gorm.ConnPool]int{}
+	for i := 0; i < 10000; i++ {
+		counts[p.Resolve(pools)]++
+	}
+	// Expect roughly 9:1.
+	require.True(t, counts[pools[0]] > 8500)
+	require.True(t, counts[pools[1]] > 500)
+}
+
+func TestRoundRobinPolicy(t *testing.T) {
+	pools := testPools(3)
+	p := &RoundRobinPolicy{}
+	for i := 0; i < 6; i++ {
+		require.Equal(t, pools[i%3], p.Resolve(pools))
+	}
+}
+
+func TestEWMALatencyPolicy(t *testing.T) {
+	pools := testPools(2)
+	p := NewEWMALatencyPolicy()
+	p.Observe(pools[0], 100*time.Millisecond)
+	p.Observe(pools[1], time.Millisecond)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, pools[1], p.Resolve(pools))
+	}
+
+	// Samples decay towards the latest latency.
+	for i := 0; i < 50; i++ {
+		p.Observe(pools[0], 0)
+		p.Observe(pools[1], 10*time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		require.Equal(t, pools[0], p.Resolve(pools))
+	}
+}
+
+func TestEWMALatencyPolicyErrors(t *testing.T) {
+	pools := testPools(3)
+	p := NewEWMALatencyPolicy()
+	p.Observe(pools[1], 100*time.Millisecond)
+	// A pool failing fast scores worse than the others, including the
+	// unsampled one.
+	p.ObserveError(pools[0])
+	for i := 0; i < 20; i++ {
+		require.NotEqual(t, pools[0], p.Resolve(pools))
+	}
+	p.mu.RLock()
+	require.Equal(t, float64(time.Second), p.ewma[pools[0]])
+	p.mu.RUnlock()
+
+	p.ObserveError(pools[1])
+	p.mu.RLock()
+	require.Equal(t,
+		ewmaAlpha*10*float64(time.Second)+(1-ewmaAlpha)*float64(100*time.Millisecond),
+		p.ewma[pools[1]],
+	)
+	p.mu.RUnlock()
+}
+
+func TestPickTwo(t *testing.T) {
+	pools := testPools(2)
+	score := func(pool gorm.ConnPool) float64 {
+		if pool == pools[0] {
+			return 1
+		}
+		return 0
+	}
+	for i := 0; i < 10; i++ {
+		require.Equal(t, pools[1], pickTwo(pools, score))
+	}
+	require.Equal(t, pools[0], pickTwo(pools[:1], score))
+}
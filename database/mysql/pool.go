@@ -0,0 +1,115 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxOpenConns    = 100
+	defaultMaxIdleConns    = 10
+	defaultConnMaxLifetime = 24 * time.Hour
+	defaultConnMaxIdleTime = time.Hour
+	defaultCreateBatchSize = 100
+)
+
+// PoolConfig defines connection pool settings for one role of the
+// cluster. Zero values are filled with defaults.
+type PoolConfig struct {
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+// withDefaults returns a copy of the pool config with zero values
+// replaced by the legacy cluster-wide limits, then the defaults.
+func (p PoolConfig) withDefaults(maxOpen, maxIdle int) PoolConfig {
+	if p.MaxOpenConns == 0 {
+		p.MaxOpenConns = maxOpen
+	}
+	if p.MaxOpenConns == 0 {
+		p.MaxOpenConns = defaultMaxOpenConns
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = maxIdle
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = defaultMaxIdleConns
+		if p.MaxIdleConns > p.MaxOpenConns {
+			p.MaxIdleConns = p.MaxOpenConns
+		}
+	}
+	if p.ConnMaxLifetime == 0 {
+		p.ConnMaxLifetime = defaultConnMaxLifetime
+	}
+	if p.ConnMaxIdleTime == 0 {
+		p.ConnMaxIdleTime = defaultConnMaxIdleTime
+	}
+	return p
+}
+
+func (p PoolConfig) validate() error {
+	if p.MaxOpenConns < 0 {
+		return errors.Errorf("max_open_conns must not be negative: %d",
+			p.MaxOpenConns)
+	}
+	if p.MaxIdleConns < 0 {
+		return errors.Errorf("max_idle_conns must not be negative: %d",
+			p.MaxIdleConns)
+	}
+	if p.MaxOpenConns > 0 && p.MaxIdleConns > p.MaxOpenConns {
+		return errors.Errorf("max_idle_conns %d exceeds max_open_conns %d",
+			p.MaxIdleConns, p.MaxOpenConns)
+	}
+	if p.ConnMaxLifetime < 0 {
+		return errors.Errorf("conn_max_lifetime must not be negative: %v",
+			p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime < 0 {
+		return errors.Errorf("conn_max_idle_time must not be negative: %v",
+			p.ConnMaxIdleTime)
+	}
+	return nil
+}
+
+func (p PoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// masterPool returns the effective pool settings for the master.
+func (c Config) masterPool() PoolConfig {
+	return c.MasterPool.withDefaults(c.MaxOpenConns, c.MaxIdleConns)
+}
+
+// slavePool returns the effective pool settings for each replica.
+func (c Config) slavePool() PoolConfig {
+	return c.SlavePool.withDefaults(c.MaxOpenConns, c.MaxIdleConns)
+}
+
+// validatePools checks the effective pool settings of both roles.
+func (c Config) validatePools() error {
+	if err := c.masterPool().validate(); err != nil {
+		return errors.Wrap(err, "master pool")
+	}
+	if err := c.slavePool().validate(); err != nil {
+		return errors.Wrap(err, "slave pool")
+	}
+	if c.CreateBatchSize < 0 {
+		return errors.Errorf("create_batch_size must not be negative: %d",
+			c.CreateBatchSize)
+	}
+	return nil
+}
+
+func (c Config) createBatchSize() int {
+	if c.CreateBatchSize == 0 {
+		return defaultCreateBatchSize
+	}
+	return c.CreateBatchSize
+}
@@ -0,0 +1,51 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestPoolDefaults(t *testing.T) {
+	cfg := Config{}
+	p := cfg.masterPool()
+	require.Equal(t, defaultMaxOpenConns, p.MaxOpenConns)
+	require.Equal(t, defaultMaxIdleConns, p.MaxIdleConns)
+	require.Equal(t, defaultConnMaxLifetime, p.ConnMaxLifetime)
+	require.Equal(t, defaultConnMaxIdleTime, p.ConnMaxIdleTime)
+	require.Equal(t, defaultCreateBatchSize, cfg.createBatchSize())
+
+	// Legacy cluster-wide limits apply to both roles.
+	cfg = Config{
+		MaxOpenConns: 50,
+		MaxIdleConns: 5,
+		SlavePool: PoolConfig{
+			MaxOpenConns:    200,
+			ConnMaxLifetime: time.Hour,
+		},
+	}
+	p = cfg.masterPool()
+	require.Equal(t, 50, p.MaxOpenConns)
+	require.Equal(t, 5, p.MaxIdleConns)
+	p = cfg.slavePool()
+	require.Equal(t, 200, p.MaxOpenConns)
+	require.Equal(t, 5, p.MaxIdleConns)
+	require.Equal(t, time.Hour, p.ConnMaxLifetime)
+
+	// Default idle limit never exceeds an explicit open limit.
+	cfg = Config{MasterPool: PoolConfig{MaxOpenConns: 4}}
+	require.Equal(t, 4, cfg.masterPool().MaxIdleConns)
+	require.NoError(t, cfg.validatePools())
+}
+
+func TestPoolValidate(t *testing.T) {
+	cfg := Config{MasterPool: PoolConfig{MaxOpenConns: 4, MaxIdleConns: 8}}
+	require.ErrorContains(t, "master pool", cfg.validatePools())
+
+	cfg = Config{SlavePool: PoolConfig{ConnMaxIdleTime: -time.Second}}
+	require.ErrorContains(t, "slave pool", cfg.validatePools())
+
+	cfg = Config{CreateBatchSize: -1}
+	require.ErrorContains(t, "create_batch_size", cfg.validatePools())
+}
@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/photon-storage/go-common/log"
+)
+
+const defaultSecretRefreshInterval = time.Minute
+
+var (
+	ErrSecretEmpty            = errors.New("secret is empty")
+	ErrPasswordSourceConflict = errors.New("more than one password source configured")
+)
+
+// SecretProvider supplies a secret such as a database password.
+// It is consulted every time a new connection is established, so
+// implementations may return a different value after rotation.
+type SecretProvider interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// StaticSecret is a fixed secret value.
+type StaticSecret string
+
+func (s StaticSecret) Secret(context.Context) (string, error) {
+	return string(s), nil
+}
+
+// FileSecret reads the secret from the named file. Surrounding
+// whitespace, including the trailing newline, is stripped.
+type FileSecret string
+
+func (s FileSecret) Secret(context.Context) (string, error) {
+	b, err := os.ReadFile(string(s))
+	if err != nil {
+		return "", errors.Wrap(err, "read secret file")
+	}
+
+	v := strings.TrimSpace(string(b))
+	if v == "" {
+		return "", errors.Wrapf(ErrSecretEmpty, "file %s", string(s))
+	}
+	return v, nil
+}
+
+// EnvSecret reads the secret from the named environment variable.
+type EnvSecret string
+
+func (s EnvSecret) Secret(context.Context) (string, error) {
+	v, ok := os.LookupEnv(string(s))
+	if !ok || v == "" {
+		return "", errors.Wrapf(ErrSecretEmpty, "env %s", string(s))
+	}
+	return v, nil
+}
+
+type cachedSecret struct {
+	provider SecretProvider
+	interval time.Duration
+
+	mu        sync.Mutex
+	value     string
+	fetchedAt time.Time
+}
+
+// NewCachedSecret wraps a provider so that the underlying source is
+// re-read at most once per interval. If a refresh fails after a
+// successful read, the last known value is kept.
+func NewCachedSecret(p SecretProvider, interval time.Duration) SecretProvider {
+	return &cachedSecret{
+		provider: p,
+		interval: interval,
+	}
+}
+
+func (s *cachedSecret) Secret(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < s.interval {
+		return s.value, nil
+	}
+
+	v, err := s.provider.Secret(ctx)
+	if err != nil {
+		if s.fetchedAt.IsZero() {
+			return "", err
+		}
+
+		log.Warn("Failed to refresh mysql secret, using cached value",
+			"error", err,
+		)
+		// Back off until the next interval instead of hitting the
+		// source on every new connection.
+		s.fetchedAt = time.Now()
+		return s.value, nil
+	}
+
+	s.value = v
+	s.fetchedAt = time.Now()
+	return v, nil
+}
+
+// passwordProvider returns the password source configured for the
+// connection. Password files and environment variables are re-read
+// periodically to pick up rotated credentials.
+func (c Conn) passwordProvider() (SecretProvider, error) {
+	srcs := 0
+	for _, set := range []bool{
+		c.SecretProvider != nil,
+		c.Password != "",
+		c.PasswordFile != "",
+		c.PasswordEnv != "",
+	} {
+		if set {
+			srcs++
+		}
+	}
+	if srcs > 1 {
+		return nil, ErrPasswordSourceConflict
+	}
+
+	interval := c.PasswordRefreshInterval
+	if interval <= 0 {
+		interval = defaultSecretRefreshInterval
+	}
+
+	switch {
+	case c.SecretProvider != nil:
+		return c.SecretProvider, nil
+	case c.PasswordFile != "":
+		return NewCachedSecret(FileSecret(c.PasswordFile), interval), nil
+	case c.PasswordEnv != "":
+		return NewCachedSecret(EnvSecret(c.PasswordEnv), interval), nil
+	default:
+		return StaticSecret(c.Password), nil
+	}
+}
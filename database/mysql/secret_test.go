@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestFileSecret(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(fn, []byte("s3cret\n"), 0600))
+
+	v, err := FileSecret(fn).Secret(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", v)
+
+	require.NoError(t, os.WriteFile(fn, []byte("\n"), 0600))
+	_, err = FileSecret(fn).Secret(context.Background())
+	require.ErrorIs(t, ErrSecretEmpty, err)
+}
+
+func TestEnvSecret(t *testing.T) {
+	t.Setenv("TEST_MYSQL_PASSWORD", "s3cret")
+
+	v, err := EnvSecret("TEST_MYSQL_PASSWORD").Secret(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", v)
+
+	_, err = EnvSecret("TEST_MYSQL_PASSWORD_UNSET").Secret(context.Background())
+	require.ErrorIs(t, ErrSecretEmpty, err)
+}
+
+func TestCachedSecret(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(fn, []byte("v1"), 0600))
+
+	ctx := context.Background()
+	s := NewCachedSecret(FileSecret(fn), 50*time.Millisecond)
+	v, err := s.Secret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v1", v)
+
+	// Rotation is not visible until the interval elapses.
+	require.NoError(t, os.WriteFile(fn, []byte("v2"), 0600))
+	v, err = s.Secret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v1", v)
+
+	time.Sleep(60 * time.Millisecond)
+	v, err = s.Secret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v2", v)
+
+	// A failed refresh keeps the last known value.
+	require.NoError(t, os.Remove(fn))
+	time.Sleep(60 * time.Millisecond)
+	v, err = s.Secret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v2", v)
+}
+
+func TestPasswordProvider(t *testing.T) {
+	p, err := Conn{Password: "plain"}.passwordProvider()
+	require.NoError(t, err)
+	require.Equal(t, StaticSecret("plain"), p)
+
+	t.Setenv("TEST_MYSQL_PASSWORD", "from-env")
+	p, err = Conn{PasswordEnv: "TEST_MYSQL_PASSWORD"}.passwordProvider()
+	require.NoError(t, err)
+	v, err := p.Secret(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "from-env", v)
+
+	custom := StaticSecret("custom")
+	p, err = Conn{SecretProvider: custom}.passwordProvider()
+	require.NoError(t, err)
+	require.Equal(t, custom, p)
+
+	_, err = Conn{
+		Password:    "plain",
+		PasswordEnv: "TEST_MYSQL_PASSWORD",
+	}.passwordProvider()
+	require.ErrorIs(t, ErrPasswordSourceConflict, err)
+}
@@ -0,0 +1,343 @@
+package mysql
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	ShardingHash  = "hash"
+	ShardingRange = "range"
+)
+
+var (
+	ErrShardingInvalid = errors.New("invalid sharding config")
+	ErrClusterNotFound = errors.New("cluster not found")
+)
+
+// ClusterConfig defines a named master/slaves cluster of a sharded
+// deployment.
+type ClusterConfig struct {
+	Name string `yaml:"name"`
+	// Tables lists unsharded tables homed on the cluster. Queries on
+	// them through ShardedDB.Global are routed to this cluster.
+	Tables []string `yaml:"tables"`
+	Config `yaml:",inline"`
+}
+
+// ShardedConfig defines a set of clusters sharing the same schema.
+// The first cluster also serves unsharded tables not listed on any
+// other cluster.
+type ShardedConfig struct {
+	Clusters []ClusterConfig `yaml:"clusters"`
+	// Sharding selects how keys map to clusters: hash (default) or
+	// range.
+	Sharding string `yaml:"sharding"`
+	// RangeBounds are the exclusive upper bounds of the key ranges
+	// served by all but the last cluster, in cluster order. Only used
+	// by range sharding.
+	RangeBounds []uint64 `yaml:"range_bounds"`
+}
+
+// Sharder maps a shard key to a cluster index in [0, n).
+type Sharder interface {
+	Shard(key []byte) int
+}
+
+// HashSharder distributes keys evenly over n clusters with jump
+// consistent hashing, so growing n moves as few keys as possible.
+type HashSharder struct {
+	n int
+}
+
+func NewHashSharder(n int) *HashSharder {
+	return &HashSharder{n: n}
+}
+
+func (s *HashSharder) Shard(key []byte) int {
+	h := fnv.New64a()
+	h.Write(key)
+	return jumpHash(h.Sum64(), s.n)
+}
+
+// jumpHash implements "A Fast, Minimal Memory, Consistent Hash
+// Algorithm" by Lamping and Veach.
+func jumpHash(key uint64, n int) int {
+	b, j := int64(-1), int64(0)
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// RangeSharder assigns keys to clusters by range. Keys are read as
+// big-endian unsigned integers, see Uint64Key. Cluster i serves keys
+// below bounds[i], the last cluster serves all remaining keys.
+type RangeSharder struct {
+	bounds []uint64
+}
+
+// NewRangeSharder creates a range sharder over len(bounds)+1
+// clusters. The bounds must be strictly increasing.
+func NewRangeSharder(bounds []uint64) (*RangeSharder, error) {
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return nil, errors.Wrap(
+				ErrShardingInvalid,
+				"range bounds must be strictly increasing",
+			)
+		}
+	}
+	return &RangeSharder{bounds: bounds}, nil
+}
+
+func (s *RangeSharder) Shard(key []byte) int {
+	v := keyUint64(key)
+	return sort.Search(len(s.bounds), func(i int) bool {
+		return v < s.bounds[i]
+	})
+}
+
+// Uint64Key encodes an integer shard key. The encoding preserves
+// ordering for range sharding.
+func Uint64Key(v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return b[:]
+}
+
+// keyUint64 reads up to the first 8 bytes of key as a big-endian
+// integer. Shorter keys are right aligned.
+func keyUint64(key []byte) uint64 {
+	if len(key) > 8 {
+		key = key[:8]
+	}
+	var b [8]byte
+	copy(b[8-len(key):], key)
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// ShardedDB routes queries to one of several clusters by shard key.
+type ShardedDB struct {
+	names    []string
+	clusters []*gorm.DB
+	sharder  Sharder
+}
+
+// NewShardedDB creates all clusters of a sharded deployment. Each
+// cluster is set up as by NewMySQLDBContext.
+func NewShardedDB(ctx context.Context, cfg ShardedConfig) (*ShardedDB, error) {
+	sharder, err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make([]*cluster, 0, len(cfg.Clusters))
+	closeAll := func() {
+		for _, c := range clusters {
+			c.close()
+		}
+	}
+	for _, cc := range cfg.Clusters {
+		c, err := newCluster(cc.Name, cc.Config)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "cluster %s", cc.Name)
+		}
+		clusters = append(clusters, c)
+	}
+
+	for i, c := range clusters {
+		if err := waitReady(ctx, c.nodes, c.cfg.Startup); err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "cluster %s", cfg.Clusters[i].Name)
+		}
+	}
+
+	var routes []tableRoute
+	for i, cc := range cfg.Clusters[1:] {
+		if len(cc.Tables) > 0 {
+			routes = append(routes, tableRoute{
+				cluster: clusters[i+1],
+				tables:  cc.Tables,
+			})
+		}
+	}
+
+	s := &ShardedDB{sharder: sharder}
+	for i, c := range clusters {
+		var r []tableRoute
+		if i == 0 {
+			r = routes
+		}
+		db, err := c.open(ctx, r)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "cluster %s", cfg.Clusters[i].Name)
+		}
+		s.names = append(s.names, cfg.Clusters[i].Name)
+		s.clusters = append(s.clusters, db)
+	}
+
+	return s, nil
+}
+
+func (c ShardedConfig) validate() (Sharder, error) {
+	if len(c.Clusters) == 0 {
+		return nil, errors.Wrap(ErrShardingInvalid, "no cluster configured")
+	}
+
+	names := map[string]bool{}
+	tables := map[string]string{}
+	for _, cc := range c.Clusters {
+		if cc.Name == "" {
+			return nil, errors.Wrap(ErrShardingInvalid, "cluster name is empty")
+		}
+		if names[cc.Name] {
+			return nil, errors.Wrapf(
+				ErrShardingInvalid,
+				"duplicate cluster name %s",
+				cc.Name,
+			)
+		}
+		names[cc.Name] = true
+
+		for _, t := range cc.Tables {
+			if other, ok := tables[t]; ok {
+				return nil, errors.Wrapf(
+					ErrShardingInvalid,
+					"table %s listed on clusters %s and %s",
+					t, other, cc.Name,
+				)
+			}
+			tables[t] = cc.Name
+		}
+	}
+
+	switch c.Sharding {
+	case "", ShardingHash:
+		return NewHashSharder(len(c.Clusters)), nil
+	case ShardingRange:
+		if len(c.RangeBounds) != len(c.Clusters)-1 {
+			return nil, errors.Wrapf(
+				ErrShardingInvalid,
+				"%d range bounds for %d clusters",
+				len(c.RangeBounds), len(c.Clusters),
+			)
+		}
+		return NewRangeSharder(c.RangeBounds)
+	default:
+		return nil, errors.Wrapf(
+			ErrShardingInvalid,
+			"unknown sharding %q",
+			c.Sharding,
+		)
+	}
+}
+
+// Shard returns the cluster serving the given shard key.
+func (s *ShardedDB) Shard(key []byte) *gorm.DB {
+	return s.clusters[s.sharder.Shard(key)]
+}
+
+// ShardByID returns the cluster serving an integer shard key.
+func (s *ShardedDB) ShardByID(id uint64) *gorm.DB {
+	return s.Shard(Uint64Key(id))
+}
+
+// Global returns the DB for unsharded tables. Tables listed on a
+// cluster are routed to it, all others are served by the first
+// cluster.
+func (s *ShardedDB) Global() *gorm.DB {
+	return s.clusters[0]
+}
+
+// Cluster returns the named cluster.
+func (s *ShardedDB) Cluster(name string) (*gorm.DB, error) {
+	for i, n := range s.names {
+		if n == name {
+			return s.clusters[i], nil
+		}
+	}
+	return nil, errors.Wrap(ErrClusterNotFound, name)
+}
+
+// Names returns the cluster names in config order.
+func (s *ShardedDB) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+// FanOut runs fn against every cluster concurrently, e.g. for
+// cross-shard scans. The context passed to fn is cancelled as soon as
+// one call fails, and the first error is returned.
+func (s *ShardedDB) FanOut(
+	ctx context.Context,
+	fn func(ctx context.Context, name string, db *gorm.DB) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	for i := range s.clusters {
+		wg.Add(1)
+		go func(name string, db *gorm.DB) {
+			defer wg.Done()
+			if err := fn(ctx, name, db.WithContext(ctx)); err != nil {
+				once.Do(func() {
+					first = errors.Wrapf(err, "cluster %s", name)
+					cancel()
+				})
+			}
+		}(s.names[i], s.clusters[i])
+	}
+	wg.Wait()
+
+	return first
+}
+
+// FanOutQuery runs query against every cluster concurrently and
+// concatenates the results in cluster order.
+func FanOutQuery[T any](
+	ctx context.Context,
+	s *ShardedDB,
+	query func(db *gorm.DB) ([]T, error),
+) ([]T, error) {
+	results := make([][]T, len(s.clusters))
+	idx := map[string]int{}
+	for i, n := range s.names {
+		idx[n] = i
+	}
+
+	if err := s.FanOut(ctx, func(
+		ctx context.Context,
+		name string,
+		db *gorm.DB,
+	) error {
+		rows, err := query(db)
+		if err != nil {
+			return err
+		}
+		results[idx[name]] = rows
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var all []T
+	for _, rows := range results {
+		all = append(all, rows...)
+	}
+	return all, nil
+}
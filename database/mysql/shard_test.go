@@ -0,0 +1,242 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestHashSharder(t *testing.T) {
+	s := NewHashSharder(4)
+	counts := make([]int, 4)
+	for i := 0; i < 4000; i++ {
+		key := []byte(fmt.Sprintf("object-%d", i))
+		idx := s.Shard(key)
+		require.Equal(t, idx, s.Shard(key))
+		counts[idx]++
+	}
+	for _, c := range counts {
+		require.True(t, c > 800)
+	}
+
+	// Growing the cluster count only moves keys to the new cluster.
+	grown := NewHashSharder(5)
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("object-%d", i))
+		if idx := grown.Shard(key); idx != 4 {
+			require.Equal(t, s.Shard(key), idx)
+		}
+	}
+}
+
+func TestRangeSharder(t *testing.T) {
+	_, err := NewRangeSharder([]uint64{10, 10})
+	require.ErrorIs(t, ErrShardingInvalid, err)
+
+	s, err := NewRangeSharder([]uint64{100, 200})
+	require.NoError(t, err)
+	require.Equal(t, 0, s.Shard(Uint64Key(0)))
+	require.Equal(t, 0, s.Shard(Uint64Key(99)))
+	require.Equal(t, 1, s.Shard(Uint64Key(100)))
+	require.Equal(t, 1, s.Shard(Uint64Key(199)))
+	require.Equal(t, 2, s.Shard(Uint64Key(200)))
+	require.Equal(t, 2, s.Shard(Uint64Key(1<<63)))
+	require.Equal(t, 1, s.Shard([]byte{150}))
+}
+
+func TestShardedConfigValidate(t *testing.T) {
+	clusters := []ClusterConfig{
+		{Name: "a", Tables: []string{"users"}},
+		{Name: "b", Tables: []string{"buckets"}},
+	}
+
+	_, err := ShardedConfig{}.validate()
+	require.ErrorIs(t, ErrShardingInvalid, err)
+
+	s, err := ShardedConfig{Clusters: clusters}.validate()
+	require.NoError(t, err)
+	_, ok := s.(*HashSharder)
+	require.True(t, ok)
+
+	s, err = ShardedConfig{
+		Clusters:    clusters,
+		Sharding:    ShardingRange,
+		RangeBounds: []uint64{1000},
+	}.validate()
+	require.NoError(t, err)
+	_, ok = s.(*RangeSharder)
+	require.True(t, ok)
+
+	_, err = ShardedConfig{
+		Clusters: clusters,
+		Sharding: ShardingRange,
+	}.validate()
+	require.ErrorIs(t, ErrShardingInvalid, err)
+
+	_, err = ShardedConfig{
+		Clusters: clusters,
+		Sharding: "modulo",
+	}.validate()
+	require.ErrorIs(t, ErrShardingInvalid, err)
+
+	_, err = ShardedConfig{
+		Clusters: []ClusterConfig{{Name: "a"}, {Name: "a"}},
+	}.validate()
+	require.ErrorIs(t, ErrShardingInvalid, err)
+
+	_, err = ShardedConfig{
+		Clusters: []ClusterConfig{
+			{Name: "a", Tables: []string{"users"}},
+			{Name: "b", Tables: []string{"users"}},
+		},
+	}.validate()
+	require.ErrorIs(t, ErrShardingInvalid, err)
+}
+
+func dryRunSharded(t *testing.T, names ...string) *ShardedDB {
+	s := &ShardedDB{sharder: NewHashSharder(len(names))}
+	for _, n := range names {
+		db, _, _ := dryRunCluster(t)
+		s.names = append(s.names, n)
+		s.clusters = append(s.clusters, db)
+	}
+	return s
+}
+
+func TestShardedDB(t *testing.T) {
+	s := dryRunSharded(t, "a", "b", "c")
+
+	db, err := s.Cluster("b")
+	require.NoError(t, err)
+	require.Equal(t, s.clusters[1], db)
+	_, err = s.Cluster("d")
+	require.ErrorIs(t, ErrClusterNotFound, err)
+
+	require.Equal(t, s.clusters[0], s.Global())
+	require.Equal(t, s.Shard(Uint64Key(42)), s.ShardByID(42))
+	require.DeepEqual(t, []string{"a", "b", "c"}, s.Names())
+}
+
+func TestFanOut(t *testing.T) {
+	s := dryRunSharded(t, "a", "b", "c")
+
+	rows, err := FanOutQuery(
+		context.Background(),
+		s,
+		func(db *gorm.DB) ([]string, error) {
+			tx := db.Table("objects").Where("id > ?", 10).Find(&[]struct{}{})
+			return []string{tx.Statement.SQL.String()}, tx.Error
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(rows))
+	for _, r := range rows {
+		require.Equal(t, "SELECT * FROM `objects` WHERE id > ?", r)
+	}
+
+	errFailed := errors.New("failed")
+	err = s.FanOut(
+		context.Background(),
+		func(ctx context.Context, name string, db *gorm.DB) error {
+			if name == "b" {
+				return errFailed
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	)
+	require.ErrorIs(t, errFailed, err)
+}
+
+type shardTestUser struct {
+	ID uint64
+}
+
+type shardTestBucket struct {
+	ID uint64
+}
+
+func mockCluster(
+	t *testing.T,
+	cfg Config,
+	replicas int,
+) (*cluster, []sqlmock.Sqlmock) {
+	var mocks []sqlmock.Sqlmock
+	dialector := func() gorm.Dialector {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		mocks = append(mocks, mock)
+		return mysql.New(mysql.Config{
+			Conn:                      db,
+			SkipInitializeWithVersion: true,
+		})
+	}
+
+	cfg.SetDefaults()
+	c := &cluster{
+		cfg:     cfg,
+		master:  dialector(),
+		policy:  NewEWMALatencyPolicy(),
+		metrics: NewMetricsPlugin(),
+	}
+	for i := 0; i < replicas; i++ {
+		c.replicas = append(c.replicas, dialector())
+	}
+	return c, mocks
+}
+
+func TestGlobalRouting(t *testing.T) {
+	global, globalMocks := mockCluster(t, Config{}, 0)
+	routed, routedMocks := mockCluster(t, Config{Metrics: true}, 2)
+
+	db, err := global.open(context.Background(), []tableRoute{{
+		cluster: routed,
+		tables:  []string{"shard_test_buckets"},
+	}})
+	require.NoError(t, err)
+
+	// Reads of routed tables go to the replicas of their cluster, and
+	// feed its replica policy and metrics.
+	for _, mock := range routedMocks[1:] {
+		mock.ExpectQuery("SELECT \\* FROM `shard_test_buckets`").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	}
+	var buckets []shardTestBucket
+	tx := db.Find(&buckets)
+	require.NoError(t, tx.Error)
+	require.Equal(t, 1, len(buckets))
+
+	ewma := routed.policy.(*EWMALatencyPolicy)
+	ewma.mu.RLock()
+	_, observed := ewma.ewma[tx.Statement.ConnPool]
+	ewma.mu.RUnlock()
+	require.True(t, observed)
+	_, ok := gatherMetric(t, "mysql_query_latency_ms", map[string]string{
+		"table": "shard_test_buckets",
+		"op":    "query",
+	})
+	require.True(t, ok)
+
+	// Writes of routed tables go to the master of their cluster.
+	routedMocks[0].ExpectBegin()
+	routedMocks[0].ExpectExec("INSERT INTO `shard_test_buckets`").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	routedMocks[0].ExpectCommit()
+	require.NoError(t, db.Create(&shardTestBucket{}).Error)
+	require.NoError(t, routedMocks[0].ExpectationsWereMet())
+
+	// Other tables are served by the global cluster.
+	globalMocks[0].ExpectQuery("SELECT \\* FROM `shard_test_users`").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	var users []shardTestUser
+	require.NoError(t, db.Find(&users).Error)
+	require.NoError(t, globalMocks[0].ExpectationsWereMet())
+}
@@ -0,0 +1,129 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/photon-storage/go-common/log"
+)
+
+const (
+	defaultStartupInitialBackoff = 500 * time.Millisecond
+	defaultStartupMaxBackoff     = 10 * time.Second
+	defaultStartupPingTimeout    = 5 * time.Second
+)
+
+var (
+	ErrNotReady = errors.New("mysql not ready")
+)
+
+// StartupConfig defines how NewMySQLDB waits for the cluster.
+type StartupConfig struct {
+	// Timeout is the overall deadline for all nodes to become
+	// reachable. Zero pings each node once without retrying.
+	Timeout time.Duration `yaml:"timeout"`
+	// InitialBackoff and MaxBackoff bound the exponential backoff
+	// between attempts. Default to 500ms and 10s.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// PingTimeout bounds a single ping. Defaults to 5s.
+	PingTimeout time.Duration `yaml:"ping_timeout"`
+}
+
+func (c StartupConfig) withDefaults() StartupConfig {
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultStartupInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultStartupMaxBackoff
+	}
+	if c.PingTimeout <= 0 {
+		c.PingTimeout = defaultStartupPingTimeout
+	}
+	return c
+}
+
+type node struct {
+	name string
+	addr string
+	db   *sql.DB
+}
+
+// waitReady pings all nodes until each has answered once, retrying
+// with backoff until the startup deadline or ctx is done. The
+// returned error names every node still unreachable.
+func waitReady(ctx context.Context, nodes []node, cfg StartupConfig) error {
+	cfg = cfg.withDefaults()
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	pending := nodes
+	backoff := cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		errs := pingAll(ctx, pending, cfg.PingTimeout)
+
+		var failed []node
+		var msgs []string
+		for i, n := range pending {
+			if errs[i] == nil {
+				continue
+			}
+			failed = append(failed, n)
+			msgs = append(msgs, fmt.Sprintf("%s (%s): %v", n.name, n.addr, errs[i]))
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+
+		notReady := errors.Wrap(ErrNotReady, strings.Join(msgs, "; "))
+		if cfg.Timeout <= 0 {
+			return notReady
+		}
+
+		log.Warn("Waiting for mysql",
+			"attempt", attempt,
+			"backoff", backoff,
+			"error", notReady,
+		)
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return notReady
+
+		case <-t.C:
+		}
+
+		pending = failed
+		backoff *= 2
+		if backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
+
+func pingAll(ctx context.Context, nodes []node, timeout time.Duration) []error {
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func(i int, n node) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			errs[i] = n.db.PingContext(ctx)
+		}(i, n)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,57 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestWaitReady(t *testing.T) {
+	nodes := []node{
+		{name: "master", addr: "127.0.0.1:1", db: unreachableDB(t)},
+		{name: "slave0", addr: "127.0.0.1:1", db: unreachableDB(t)},
+	}
+
+	// No retry without a startup timeout.
+	start := time.Now()
+	err := waitReady(context.Background(), nodes, StartupConfig{})
+	require.ErrorIs(t, ErrNotReady, err)
+	require.ErrorContains(t, "master (127.0.0.1:1)", err)
+	require.ErrorContains(t, "slave0 (127.0.0.1:1)", err)
+	require.True(t, time.Since(start) < time.Second)
+
+	start = time.Now()
+	err = waitReady(context.Background(), nodes, StartupConfig{
+		Timeout:        300 * time.Millisecond,
+		InitialBackoff: 50 * time.Millisecond,
+	})
+	require.ErrorIs(t, ErrNotReady, err)
+	require.True(t, time.Since(start) >= 300*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = waitReady(ctx, nodes, StartupConfig{Timeout: time.Minute})
+	require.ErrorIs(t, ErrNotReady, err)
+}
+
+func TestNewMySQLDBNotReady(t *testing.T) {
+	_, err := NewMySQLDB(Config{
+		Master: Conn{Host: "127.0.0.1", Port: 1, Username: "root"},
+	})
+	require.ErrorIs(t, ErrNotReady, err)
+}
+
+func TestNewMySQLDBContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, err := NewMySQLDBContext(ctx, Config{
+		Master:  Conn{Host: "127.0.0.1", Port: 1, Username: "root"},
+		Startup: StartupConfig{Timeout: time.Minute},
+	})
+	require.ErrorIs(t, ErrNotReady, err)
+	require.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,128 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/photon-storage/go-common/log"
+	"github.com/photon-storage/go-common/metrics"
+)
+
+const (
+	defaultTxMaxRetries  = 3
+	defaultTxBaseBackoff = 10 * time.Millisecond
+	defaultTxMaxBackoff  = time.Second
+)
+
+var declareTxMetrics sync.Once
+
+// TxOptions defines transaction settings for WithTx.
+type TxOptions struct {
+	// Isolation is the isolation level. Zero uses the server default.
+	Isolation sql.IsolationLevel
+	// ReadOnly starts a read only transaction.
+	ReadOnly bool
+	// MaxRetries is the number of retries after a deadlock or lock
+	// wait timeout. Defaults to 3. A negative value disables retries.
+	MaxRetries int
+	// BaseBackoff and MaxBackoff bound the exponential backoff between
+	// retries. Each wait is jittered to [backoff/2, backoff). Default
+	// to 10ms and 1s.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func (o *TxOptions) withDefaults() TxOptions {
+	var opts TxOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultTxMaxRetries
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = defaultTxBaseBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultTxMaxBackoff
+	}
+	return opts
+}
+
+func (o TxOptions) backoff(attempt int) time.Duration {
+	d := o.MaxBackoff
+	if attempt < 32 {
+		if b := o.BaseBackoff << attempt; b > 0 && b < d {
+			d = b
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// WithTx runs fn in a transaction, committing if fn returns nil and
+// rolling back otherwise. The whole transaction is retried with
+// jittered exponential backoff when it fails on a deadlock or lock
+// wait timeout. fn must therefore be safe to run more than once.
+// opts may be nil.
+func WithTx(
+	ctx context.Context,
+	db *gorm.DB,
+	opts *TxOptions,
+	fn func(tx *gorm.DB) error,
+) error {
+	o := opts.withDefaults()
+	declareTxMetrics.Do(func() {
+		metrics.NewCounter("mysql_tx_retries_total.reason#deadlock")
+		metrics.NewCounter("mysql_tx_retries_total.reason#lock_wait_timeout")
+		metrics.NewCounter("mysql_tx_retries_exhausted_total")
+	})
+
+	txOpts := &sql.TxOptions{
+		Isolation: o.Isolation,
+		ReadOnly:  o.ReadOnly,
+	}
+	for attempt := 0; ; attempt++ {
+		err := db.WithContext(ctx).Transaction(fn, txOpts)
+		reason, retryable := retryReason(err)
+		if !retryable {
+			return err
+		}
+		if attempt >= o.MaxRetries {
+			metrics.CounterInc("mysql_tx_retries_exhausted_total")
+			return err
+		}
+
+		metrics.CounterInc("mysql_tx_retries_total.reason#" + reason)
+		log.Debug("Retrying mysql transaction",
+			"attempt", attempt+1,
+			"reason", reason,
+			"error", err,
+		)
+
+		t := time.NewTimer(o.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+
+		case <-t.C:
+		}
+	}
+}
+
+// retryReason reports whether the transaction failed with a transient
+// lock conflict worth retrying.
+func retryReason(err error) (string, bool) {
+	switch {
+	case IsDeadlock(err):
+		return "deadlock", true
+	case IsLockTimeout(err):
+		return "lock_wait_timeout", true
+	}
+	return "", false
+}
@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestRetryReason(t *testing.T) {
+	reason, ok := retryReason(errors.Wrap(
+		&gomysql.MySQLError{Number: ErLockDeadlock},
+		"update",
+	))
+	require.True(t, ok)
+	require.Equal(t, "deadlock", reason)
+
+	reason, ok = retryReason(&gomysql.MySQLError{Number: ErLockWaitTimeout})
+	require.True(t, ok)
+	require.Equal(t, "lock_wait_timeout", reason)
+
+	_, ok = retryReason(&gomysql.MySQLError{Number: 1062})
+	require.False(t, ok)
+	_, ok = retryReason(errors.New("boom"))
+	require.False(t, ok)
+	_, ok = retryReason(nil)
+	require.False(t, ok)
+}
+
+func TestTxBackoff(t *testing.T) {
+	var nilOpts *TxOptions
+	o := nilOpts.withDefaults()
+	require.Equal(t, defaultTxMaxRetries, o.MaxRetries)
+
+	o = (&TxOptions{
+		BaseBackoff: 10 * time.Millisecond,
+		MaxBackoff:  100 * time.Millisecond,
+	}).withDefaults()
+	for attempt, max := range []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		100 * time.Millisecond,
+		100 * time.Millisecond,
+	} {
+		d := o.backoff(attempt)
+		require.True(t, d >= max/2 && d <= max, attempt, d)
+	}
+	require.True(t, o.backoff(100) <= 100*time.Millisecond)
+}
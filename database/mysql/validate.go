@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const defaultPort = 3306
+
+var (
+	ErrConfigInvalid = errors.New("invalid mysql config")
+)
+
+// SetDefaults fills zero values with their defaults. NewMySQLDB
+// applies the same defaults, so calling it is only needed to inspect
+// the effective config.
+func (c *Config) SetDefaults() {
+	c.Master.setDefaults()
+	for i := range c.Slaves {
+		c.Slaves[i].setDefaults()
+	}
+
+	c.MasterPool = c.masterPool()
+	c.SlavePool = c.slavePool()
+	c.CreateBatchSize = c.createBatchSize()
+	c.SlowThreshold = c.slowThreshold()
+	if c.LogLevel == "" {
+		c.LogLevel = "info"
+	}
+	if c.Policy == "" {
+		c.Policy = RandomPolicyName
+	}
+	if c.HealthCheck.Enabled {
+		c.HealthCheck = c.HealthCheck.withDefaults()
+	}
+	c.Startup = c.Startup.withDefaults()
+}
+
+func (c *Conn) setDefaults() {
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+}
+
+// Validate checks the config and reports all problems found. Zero
+// values that have defaults are accepted.
+func (c Config) Validate() error {
+	var errs []string
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	c.Master.validate("master", add)
+	for i, slave := range c.Slaves {
+		slave.validate(fmt.Sprintf("slaves[%d]", i), add)
+		if slave.Weight < 0 {
+			add("slaves[%d].weight must not be negative: %d", i, slave.Weight)
+		}
+	}
+
+	if err := c.validatePools(); err != nil {
+		add("%v", err)
+	}
+
+	switch c.LogLevel {
+	case "", "silent", "error", "warn", "info":
+	default:
+		add("log_level %q is not one of silent, error, warn, info",
+			c.LogLevel)
+	}
+
+	if _, err := newPolicy(c.Policy, nil); err != nil {
+		add("policy %q is not one of %s, %s, %s, %s, %s",
+			c.Policy,
+			RandomPolicyName,
+			WeightedRandomPolicyName,
+			RoundRobinPolicyName,
+			LeastInFlightPolicyName,
+			EWMALatencyPolicyName,
+		)
+	}
+
+	hc := c.HealthCheck
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.MaxLag < 0 {
+		add("health_check durations must not be negative")
+	}
+	if hc.FailureThreshold < 0 {
+		add("health_check.failure_threshold must not be negative: %d",
+			hc.FailureThreshold)
+	}
+	if c.ReadYourWritesWindow < 0 {
+		add("read_your_writes_window must not be negative: %v",
+			c.ReadYourWritesWindow)
+	}
+	if c.Startup.Timeout < 0 {
+		add("startup.timeout must not be negative: %v", c.Startup.Timeout)
+	}
+
+	if len(errs) > 0 {
+		return errors.Wrap(ErrConfigInvalid, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (c Conn) validate(
+	name string,
+	add func(format string, args ...interface{}),
+) {
+	if c.Host == "" {
+		add("%s.host is empty", name)
+	}
+	if c.Port > 65535 {
+		add("%s.port %d is out of range", name, c.Port)
+	}
+	if c.Username == "" {
+		add("%s.username is empty", name)
+	}
+	if _, err := c.passwordProvider(); err != nil {
+		add("%s: only one of password, password_file, password_env "+
+			"and a secret provider may be set", name)
+	}
+	if c.PasswordRefreshInterval < 0 {
+		add("%s.password_refresh_interval must not be negative: %v",
+			name, c.PasswordRefreshInterval)
+	}
+	if c.Timeout < 0 || c.ReadTimeout < 0 || c.WriteTimeout < 0 {
+		add("%s timeouts must not be negative", name)
+	}
+	if c.TLS != nil && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		add("%s.tls.cert_file and %s.tls.key_file must be set together",
+			name, name)
+	}
+}
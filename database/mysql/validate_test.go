@@ -0,0 +1,52 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := Config{
+		Master: Conn{Host: "db", Username: "root"},
+		Slaves: []Conn{{Host: "replica", Username: "ro"}},
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.SetDefaults()
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, uint(defaultPort), cfg.Master.Port)
+	require.Equal(t, uint(defaultPort), cfg.Slaves[0].Port)
+	require.Equal(t, defaultMaxOpenConns, cfg.MasterPool.MaxOpenConns)
+	require.Equal(t, defaultSlowThreshold, cfg.SlowThreshold)
+	require.Equal(t, RandomPolicyName, cfg.Policy)
+
+	cfg = Config{
+		Master: Conn{
+			Port:        70000,
+			Password:    "a",
+			PasswordEnv: "B",
+			TLS:         &TLSConfig{CertFile: "cert.pem"},
+		},
+		Slaves:   []Conn{{Host: "replica", Username: "ro", Weight: -1}},
+		LogLevel: "verbose",
+		Policy:   "fastest",
+		Startup:  StartupConfig{Timeout: -time.Second},
+	}
+	err := cfg.Validate()
+	require.ErrorIs(t, ErrConfigInvalid, err)
+	for _, want := range []string{
+		"master.host is empty",
+		"master.port 70000 is out of range",
+		"master.username is empty",
+		"master: only one of password",
+		"master.tls.cert_file and master.tls.key_file",
+		"slaves[0].weight must not be negative",
+		`log_level "verbose"`,
+		`policy "fastest"`,
+		"startup.timeout must not be negative",
+	} {
+		require.ErrorContains(t, want, err)
+	}
+}
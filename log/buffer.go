@@ -0,0 +1,126 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDropReportInterval = 10 * time.Second
+	defaultOverflowLevel      = ErrorLevel
+)
+
+var (
+	ErrOverflowPolicyInvalid = errors.New("invalid log overflow policy name")
+
+	// dropped counts entries discarded on a full async buffer.
+	dropped uint64
+)
+
+// OverflowPolicy decides what happens to an entry logged in async
+// mode while the buffer is full.
+type OverflowPolicy uint32
+
+const (
+	// OverflowBlock waits for space in the buffer.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the entry being logged.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest buffered entry to make
+	// room for the new one.
+	OverflowDropOldest
+	// OverflowDropBelowLevel discards entries less severe than
+	// Options.OverflowLevel and blocks for the others.
+	OverflowDropBelowLevel
+)
+
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	switch strings.ToLower(policy) {
+	case "block":
+		return OverflowBlock, nil
+	case "drop_newest":
+		return OverflowDropNewest, nil
+	case "drop_oldest":
+		return OverflowDropOldest, nil
+	case "drop_below_level":
+		return OverflowDropBelowLevel, nil
+	}
+
+	return OverflowBlock, ErrOverflowPolicyInvalid
+}
+
+// Dropped returns the number of entries discarded on a full async
+// buffer since the process started.
+func Dropped() uint64 {
+	return atomic.LoadUint64(&dropped)
+}
+
+// enqueue adds f to the async buffer according to the overflow
+// policy. It returns false if the logger is closing and f must be
+// written synchronously.
+func (l *log) enqueue(level logrus.Level, f func()) bool {
+	switch l.overflow {
+	case OverflowDropNewest:
+		l.tryEnqueue(f)
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case l.ch <- f:
+				return true
+			default:
+			}
+
+			select {
+			case <-l.ch:
+				atomic.AddUint64(&dropped, 1)
+			default:
+			}
+		}
+
+	case OverflowDropBelowLevel:
+		if level > logrus.Level(l.overflowLevel) {
+			l.tryEnqueue(f)
+		} else {
+			return l.send(f)
+		}
+
+	default:
+		return l.send(f)
+	}
+	return true
+}
+
+// send blocks until f is buffered or the logger is closing.
+func (l *log) send(f func()) bool {
+	select {
+	case l.ch <- f:
+		return true
+	case <-l.closing:
+		return false
+	}
+}
+
+func (l *log) tryEnqueue(f func()) {
+	select {
+	case l.ch <- f:
+	default:
+		atomic.AddUint64(&dropped, 1)
+	}
+}
+
+// reportDropped warns about entries dropped since the last report.
+// It runs on the loop goroutine and bypasses the buffer.
+func (l *log) reportDropped(last *uint64) {
+	n := Dropped()
+	if n == *last {
+		return
+	}
+
+	l.logger.WithField("count", n-*last).Warn("Log entries dropped")
+	*last = n
+}
@@ -0,0 +1,93 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestParseOverflowPolicy(t *testing.T) {
+	p, err := ParseOverflowPolicy("drop_oldest")
+	require.NoError(t, err)
+	require.Equal(t, OverflowDropOldest, p)
+
+	_, err = ParseOverflowPolicy("drop_all")
+	require.ErrorIs(t, ErrOverflowPolicyInvalid, err)
+}
+
+func TestEnqueueOverflow(t *testing.T) {
+	marker := func(out *[]int, v int) func() {
+		return func() { *out = append(*out, v) }
+	}
+	drain := func(l *log) {
+		for len(l.ch) > 0 {
+			(<-l.ch)()
+		}
+	}
+
+	var out []int
+	l := &log{ch: make(chan func(), 2), overflow: OverflowDropNewest}
+	before := Dropped()
+	for i := 0; i < 4; i++ {
+		l.enqueue(logrus.InfoLevel, marker(&out, i))
+	}
+	drain(l)
+	require.DeepEqual(t, []int{0, 1}, out)
+	require.Equal(t, before+2, Dropped())
+
+	out = nil
+	l.overflow = OverflowDropOldest
+	for i := 0; i < 4; i++ {
+		l.enqueue(logrus.InfoLevel, marker(&out, i))
+	}
+	drain(l)
+	require.DeepEqual(t, []int{2, 3}, out)
+	require.Equal(t, before+4, Dropped())
+
+	out = nil
+	l.overflow = OverflowDropBelowLevel
+	l.overflowLevel = WarnLevel
+	l.enqueue(logrus.InfoLevel, marker(&out, 0))
+	l.enqueue(logrus.InfoLevel, marker(&out, 1))
+	l.enqueue(logrus.InfoLevel, marker(&out, 2))
+	done := make(chan bool)
+	go func() {
+		// Blocks until the buffer is drained.
+		l.enqueue(logrus.WarnLevel, marker(&out, 3))
+		close(done)
+	}()
+	(<-l.ch)()
+	<-done
+	drain(l)
+	require.DeepEqual(t, []int{0, 1, 3}, out)
+	require.Equal(t, before+5, Dropped())
+}
+
+func TestReportDropped(t *testing.T) {
+	hook := TestingHook(t)
+
+	last := Dropped()
+	global().reportDropped(&last)
+	require.Equal(t, 0, len(hook.AllEntries()))
+
+	global().tryEnqueue(func() {})
+	global().reportDropped(&last)
+	require.Equal(t, "Log entries dropped", hook.LastEntry().Message)
+	require.Equal(t, uint64(1), hook.LastEntry().Data["count"])
+	require.Equal(t, Dropped(), last)
+}
+
+func TestOverflowLevelDefault(t *testing.T) {
+	l := newLogger(&Options{Overflow: OverflowDropBelowLevel})
+	defer l.cancel()
+	require.Equal(t, ErrorLevel, l.overflowLevel)
+
+	l = newLogger(&Options{
+		Overflow:      OverflowDropBelowLevel,
+		OverflowLevel: WarnLevel,
+	})
+	defer l.cancel()
+	require.Equal(t, WarnLevel, l.overflowLevel)
+}
@@ -0,0 +1,109 @@
+package log
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// componentRules holds the []componentRule snapshot consulted on
+	// every entry of a named logger. Writers hold rulesMu.
+	componentRules atomic.Value
+	rulesMu        sync.Mutex
+)
+
+type componentRule struct {
+	pattern string
+	// glob is the pattern with dots as path separators.
+	glob  string
+	level Level
+}
+
+// SetComponentLevel sets the level of loggers created with Named
+// whose component matches pattern, overriding the global level.
+// Patterns use path.Match syntax on dotted component names, where
+// '*' does not match dots, e.g. "mysql.*". A pattern also applies to
+// sub-components of matching components, so "mysql" covers
+// "mysql.health.lag". When several patterns match, the one matching
+// the most specific component wins, then the longest pattern.
+func SetComponentLevel(pattern string, level Level) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules := loadRules()
+	next := make([]componentRule, 0, len(rules)+1)
+	for _, r := range rules {
+		if r.pattern != pattern {
+			next = append(next, r)
+		}
+	}
+	next = append(next, componentRule{
+		pattern: pattern,
+		glob:    strings.ReplaceAll(pattern, ".", "/"),
+		level:   level,
+	})
+	sort.SliceStable(next, func(i, j int) bool {
+		return len(next[i].pattern) > len(next[j].pattern)
+	})
+	componentRules.Store(next)
+	return nil
+}
+
+// ResetComponentLevel removes the level set for pattern.
+func ResetComponentLevel(pattern string) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules := loadRules()
+	next := make([]componentRule, 0, len(rules))
+	for _, r := range rules {
+		if r.pattern != pattern {
+			next = append(next, r)
+		}
+	}
+	componentRules.Store(next)
+}
+
+// ComponentLevels returns the component levels by pattern.
+func ComponentLevels() map[string]Level {
+	levels := map[string]Level{}
+	for _, r := range loadRules() {
+		levels[r.pattern] = r.level
+	}
+	return levels
+}
+
+func loadRules() []componentRule {
+	rules, _ := componentRules.Load().([]componentRule)
+	return rules
+}
+
+// componentLevel returns the level of the most specific rule matching
+// component or one of its ancestors.
+func componentLevel(component string) (Level, bool) {
+	rules := loadRules()
+	if len(rules) == 0 {
+		return 0, false
+	}
+
+	for name := strings.ReplaceAll(component, ".", "/"); ; {
+		for _, r := range rules {
+			if ok, _ := path.Match(r.glob, name); ok {
+				return r.level, true
+			}
+		}
+
+		i := strings.LastIndexByte(name, '/')
+		if i < 0 {
+			return 0, false
+		}
+		name = name[:i]
+	}
+}
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func resetLevels(t *testing.T) {
+	t.Cleanup(func() {
+		for p := range ComponentLevels() {
+			ResetComponentLevel(p)
+		}
+		SetLevel(InfoLevel)
+	})
+}
+
+func TestComponentLevel(t *testing.T) {
+	resetLevels(t)
+
+	require.NotNil(t, SetComponentLevel("[", DebugLevel))
+	require.NoError(t, SetComponentLevel("mysql", DebugLevel))
+	require.NoError(t, SetComponentLevel("mysql.*", WarnLevel))
+	require.NoError(t, SetComponentLevel("mysql.health", TraceLevel))
+
+	for _, c := range []struct {
+		component string
+		level     Level
+		ok        bool
+	}{
+		{"mysql", DebugLevel, true},
+		{"mysql.resolver", WarnLevel, true},
+		{"mysql.health", TraceLevel, true},
+		{"mysql.health.lag", TraceLevel, true},
+		{"mysqlx", 0, false},
+		{"api", 0, false},
+	} {
+		level, ok := componentLevel(c.component)
+		require.Equal(t, c.ok, ok, c.component)
+		require.Equal(t, c.level, level, c.component)
+	}
+
+	ResetComponentLevel("mysql.health")
+	level, _ := componentLevel("mysql.health")
+	require.Equal(t, WarnLevel, level)
+}
+
+func TestComponentLevelLogging(t *testing.T) {
+	resetLevels(t)
+	hook := TestingHook(t)
+
+	require.NoError(t, SetComponentLevel("mysql", DebugLevel))
+	require.NoError(t, SetComponentLevel("api", ErrorLevel))
+
+	Debug("Global debug")
+	Default().Named("mysql").Named("resolver").Debug("Resolver debug")
+	Default().Named("api").Warn("API warning")
+	require.Equal(t, 1, len(hook.AllEntries()))
+	require.Equal(t, "Resolver debug", hook.LastEntry().Message)
+
+	require.True(t, Default().Named("mysql").IsEnabled(DebugLevel))
+	require.False(t, Default().IsEnabled(DebugLevel))
+}
+
+func serveLevel(
+	t *testing.T,
+	h http.Handler,
+	method string,
+	target string,
+	body string,
+) (int, levelState) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var state levelState
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	}
+	return rec.Code, state
+}
+
+func TestLevelHandler(t *testing.T) {
+	resetLevels(t)
+	h := LevelHandler()
+
+	code, state := serveLevel(t, h, http.MethodGet, "/", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "info", state.Level)
+	require.Equal(t, 0, len(state.Components))
+
+	code, state = serveLevel(t, h, http.MethodPut, "/",
+		`{"component": "mysql", "level": "debug"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "debug", state.Components["mysql"])
+
+	code, state = serveLevel(t, h, http.MethodPost, "/", `{"level": "warn"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "warning", state.Level)
+	require.Equal(t, WarnLevel, GetLevel())
+
+	code, state = serveLevel(t, h, http.MethodDelete, "/?component=mysql", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 0, len(state.Components))
+
+	code, _ = serveLevel(t, h, http.MethodPut, "/", `{"level": "loud"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = serveLevel(t, h, http.MethodDelete, "/", "")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = serveLevel(t, h, http.MethodPatch, "/", "")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+func TestLevelHandlerRevert(t *testing.T) {
+	resetLevels(t)
+	h := LevelHandler()
+
+	// Consecutive temporary changes revert to the original state.
+	serveLevel(t, h, http.MethodPut, "/",
+		`{"component": "mysql", "level": "debug", "revert_after": "1h"}`)
+	serveLevel(t, h, http.MethodPut, "/",
+		`{"component": "mysql", "level": "trace", "revert_after": "20ms"}`)
+	serveLevel(t, h, http.MethodPut, "/",
+		`{"level": "debug", "revert_after": "20ms"}`)
+	require.Equal(t, TraceLevel, ComponentLevels()["mysql"])
+	require.Equal(t, DebugLevel, GetLevel())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(ComponentLevels()) == 0 && GetLevel() == InfoLevel {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("levels not reverted: %v %v", ComponentLevels(), GetLevel())
+}
@@ -0,0 +1,110 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	causesSuffix = "_causes"
+	stackSuffix  = "_stack"
+)
+
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// errorFormatter expands error values in entry fields before
+// delegating to the wrapped formatter. An error under key is
+// rendered as its message, with the messages of the wrapped errors
+// in key_causes. The pkg/errors stack trace of the innermost error
+// carrying one is added in key_stack for entries at error level and
+// above, or when debug logging is enabled.
+type errorFormatter struct {
+	formatter logrus.Formatter
+}
+
+func (f *errorFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	var data logrus.Fields
+	for k, v := range e.Data {
+		err, ok := v.(error)
+		if !ok {
+			continue
+		}
+
+		if data == nil {
+			data = make(logrus.Fields, len(e.Data)+2)
+			for k, v := range e.Data {
+				data[k] = v
+			}
+		}
+		addErrorFields(data, k, err, withStack(e))
+	}
+
+	if data != nil {
+		orig := e.Data
+		e.Data = data
+		defer func() { e.Data = orig }()
+	}
+	return f.formatter.Format(e)
+}
+
+// withStack reports whether stack traces are rendered for the entry.
+func withStack(e *logrus.Entry) bool {
+	if e.Level <= logrus.ErrorLevel {
+		return true
+	}
+
+	component, _ := e.Data[componentKey].(string)
+	return (&Logger{component: component}).enabled(logrus.DebugLevel)
+}
+
+func addErrorFields(
+	fields logrus.Fields,
+	key string,
+	err error,
+	stack bool,
+) {
+	msg := err.Error()
+	fields[key] = msg
+
+	var causes []string
+	var st errors.StackTrace
+	last := msg
+	for e := err; e != nil; e = unwrap(e) {
+		if s, ok := e.(stackTracer); ok {
+			st = s.StackTrace()
+		}
+		if m := e.Error(); m != last {
+			causes = append(causes, m)
+			last = m
+		}
+	}
+
+	if len(causes) > 0 {
+		fields[key+causesSuffix] = causes
+	}
+	if stack && len(st) > 0 {
+		frames := make([]string, 0, len(st))
+		for _, f := range st {
+			frames = append(frames, strings.Replace(
+				fmt.Sprintf("%+s:%d", f, f), "\n\t", " ", 1))
+		}
+		fields[key+stackSuffix] = frames
+	}
+}
+
+// unwrap returns the error wrapped by err, supporting both Unwrap and
+// the pkg/errors Cause method.
+func unwrap(err error) error {
+	if e := errors.Unwrap(err); e != nil {
+		return e
+	}
+	if c, ok := err.(interface{ Cause() error }); ok {
+		return c.Cause()
+	}
+	return nil
+}
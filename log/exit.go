@@ -0,0 +1,78 @@
+package log
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// terminateTimeout bounds writing pending entries, and separately
+	// the entry itself, before Fatal exits or Panic panics.
+	terminateTimeout = 5 * time.Second
+
+	exitFunc atomic.Value
+)
+
+type exitFuncBox struct {
+	fn func(code int)
+}
+
+// SetExitFunc replaces the function Fatal calls to exit the process,
+// e.g. in tests. nil restores os.Exit.
+func SetExitFunc(fn func(code int)) {
+	exitFunc.Store(exitFuncBox{fn: fn})
+}
+
+func exit(code int) {
+	if b, _ := exitFunc.Load().(exitFuncBox); b.fn != nil {
+		b.fn(code)
+		return
+	}
+	os.Exit(code)
+}
+
+// terminate handles fatal and panic entries on the calling goroutine:
+// pending entries are flushed, the entry is written and the process
+// exits or panics. Flushing and writing the entry each get their
+// own terminateTimeout, so a stalled flush neither prevents the exit
+// nor the entry from being written. It exits or panics even if the
+// level is disabled.
+func (l *Logger) terminate(level logrus.Level, v string, params []interface{}) {
+	lg := global()
+	ctx, cancel := context.WithTimeout(context.Background(), terminateTimeout)
+	lg.flush(ctx)
+	cancel()
+
+	if l.enabled(level) {
+		if f := l.entryFunc(lg, level, v, params); f != nil {
+			ctx, cancel := context.WithTimeout(
+				context.Background(), terminateTimeout)
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				// logrus panics itself after writing a panic entry.
+				defer func() {
+					if level == logrus.PanicLevel {
+						recover()
+					}
+				}()
+				f()
+			}()
+
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	if level == logrus.PanicLevel {
+		panic(v)
+	}
+	exit(1)
+}
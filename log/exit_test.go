@@ -0,0 +1,97 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func captureExit(t *testing.T) *[]int {
+	var codes []int
+	SetExitFunc(func(code int) { codes = append(codes, code) })
+	t.Cleanup(func() { SetExitFunc(nil) })
+	return &codes
+}
+
+func TestFatalFlushes(t *testing.T) {
+	initTest(t, &Options{LogLevel: InfoLevel, BufferSize: 4})
+	hook := TestingHook(t)
+	codes := captureExit(t)
+
+	for i := 0; i < 50; i++ {
+		Info("Entry", "i", i)
+	}
+	Fatal("Unrecoverable", "reason", "test")
+
+	// All pending entries are written before the fatal one, which is
+	// written before returning.
+	entries := hook.AllEntries()
+	require.Equal(t, 51, len(entries))
+	require.Equal(t, 49, entries[49].Data["i"])
+	require.Equal(t, logrus.FatalLevel, entries[50].Level)
+	require.Equal(t, "test", entries[50].Data["reason"])
+	require.DeepEqual(t, []int{1}, *codes)
+}
+
+func TestFatalDisabled(t *testing.T) {
+	initTest(t, &Options{LogLevel: PanicLevel, Sync: true})
+	hook := TestingHook(t)
+	codes := captureExit(t)
+
+	Fatal("Unrecoverable")
+	require.Equal(t, 0, len(hook.AllEntries()))
+	require.DeepEqual(t, []int{1}, *codes)
+}
+
+func TestPanic(t *testing.T) {
+	initTest(t, &Options{LogLevel: InfoLevel})
+	hook := TestingHook(t)
+	Info("Before")
+
+	func() {
+		defer func() {
+			require.Equal(t, "Invariant violated", recover())
+		}()
+		Default().Named("worker").Panic("Invariant violated", "id", 7)
+	}()
+
+	entries := hook.AllEntries()
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, logrus.PanicLevel, entries[1].Level)
+	require.Equal(t, 7, entries[1].Data["id"])
+	require.Equal(t, "worker", entries[1].Data["component"])
+}
+
+func TestFatalStalledWriter(t *testing.T) {
+	initTest(t, &Options{LogLevel: InfoLevel, BufferSize: 1})
+	h := &blockingHook{
+		unblock: make(chan struct{}),
+		levels:  []logrus.Level{logrus.InfoLevel},
+	}
+	global().logger.AddHook(h)
+	t.Cleanup(func() { close(h.unblock) })
+	hook := TestingHook(t)
+	codes := captureExit(t)
+
+	timeout := terminateTimeout
+	terminateTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { terminateTimeout = timeout })
+
+	// The loop is stuck writing the first entry and the buffer is full.
+	Info("Stuck")
+	Info("Queued")
+
+	start := time.Now()
+	Fatal("Unrecoverable")
+	require.True(t, time.Since(start) < 5*time.Second)
+	require.DeepEqual(t, []int{1}, *codes)
+
+	// The flush timed out, but the fatal entry is still written.
+	e := hook.LastEntry()
+	require.NotNil(t, e)
+	require.Equal(t, logrus.FatalLevel, e.Level)
+	require.Equal(t, "Unrecoverable", e.Message)
+}
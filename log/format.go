@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	joonix "github.com/joonix/log"
 	"github.com/sirupsen/logrus"
 )
 
@@ -56,3 +57,46 @@ func (f *TimeZoneFormatter) Format(e *logrus.Entry) ([]byte, error) {
 	}
 	return f.formatter.Format(e)
 }
+
+// locFormatter converts entry timestamps to a location before
+// delegating to the wrapped formatter.
+type locFormatter struct {
+	formatter logrus.Formatter
+	loc       *time.Location
+}
+
+func (f *locFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	if f.loc != nil {
+		e.Time = e.Time.In(f.loc)
+	}
+	return f.formatter.Format(e)
+}
+
+// newJSONFormatter creates a formatter emitting one JSON object per
+// line with the fields "time" (RFC3339Nano), "level" and "msg".
+// Error fields are expanded as described by errorFormatter.
+func newJSONFormatter(loc *time.Location) logrus.Formatter {
+	return &locFormatter{
+		formatter: &errorFormatter{
+			formatter: &logrus.JSONFormatter{
+				TimestampFormat: time.RFC3339Nano,
+				FieldMap: logrus.FieldMap{
+					logrus.FieldKeyTime:  "time",
+					logrus.FieldKeyLevel: "level",
+					logrus.FieldKeyMsg:   "msg",
+				},
+			},
+		},
+		loc: loc,
+	}
+}
+
+// newFluentdFormatter creates a formatter for fluentd and the
+// Stackdriver logging agent, using "message" and "severity" fields.
+// Error fields are expanded as in JSON format.
+func newFluentdFormatter(loc *time.Location) logrus.Formatter {
+	return &locFormatter{
+		formatter: &errorFormatter{formatter: joonix.NewFormatter()},
+		loc:       loc,
+	}
+}
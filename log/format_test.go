@@ -0,0 +1,160 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func testEntry() *logrus.Entry {
+	e := logrus.NewEntry(logrus.New())
+	e.Time = time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+	e.Level = logrus.WarnLevel
+	e.Message = "hello"
+	e.Data = logrus.Fields{"key": "value"}
+	return e
+}
+
+func TestJSONFormatter(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	b, err := newJSONFormatter(loc).Format(testEntry())
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &m))
+	require.Equal(t, "2022-01-02T11:04:05.000000006+08:00", m["time"])
+	require.Equal(t, "warning", m["level"])
+	require.Equal(t, "hello", m["msg"])
+	require.Equal(t, "value", m["key"])
+}
+
+func TestFluentdFormatter(t *testing.T) {
+	b, err := newFluentdFormatter(nil).Format(testEntry())
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &m))
+	require.Equal(t, "hello", m["message"])
+	require.Equal(t, "WARNING", m["severity"])
+	require.Equal(t, "value", m["key"])
+}
+
+func TestInitInvalidFormat(t *testing.T) {
+	require.ErrorIs(t, ErrLogFormatInvalid, Init(&Options{Format: 100}))
+}
+
+func TestJournaldHook(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{
+		Name: socket,
+		Net:  "unixgram",
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var fallback bytes.Buffer
+	h, err := newJournaldHook(socket, &fallback, newTimeZoneFormatter(nil))
+	require.NoError(t, err)
+
+	e := testEntry()
+	e.Data["multi line"] = "a\nb"
+	require.NoError(t, h.Fire(e))
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	msg := string(buf[:n])
+	require.True(t, strings.Contains(msg, "MESSAGE=hello\n"))
+	require.True(t, strings.Contains(msg, "PRIORITY=4\n"))
+	require.True(t, strings.Contains(msg, "KEY=value\n"))
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], 3)
+	require.True(t, strings.Contains(
+		msg,
+		"MULTI_LINE\n"+string(size[:])+"a\nb\n",
+	))
+	require.Equal(t, 0, fallback.Len())
+
+	// Entries the journal does not accept go to the fallback.
+	conn.Close()
+	require.NoError(t, h.Fire(testEntry()))
+	require.True(t, strings.Contains(fallback.String(), "msg=hello"))
+
+	_, err = newJournaldHook(socket, &fallback, newTimeZoneFormatter(nil))
+	require.NotNil(t, err)
+}
+
+func TestJournalFieldName(t *testing.T) {
+	require.Equal(t, "REQUEST_ID", journalFieldName("request_id"))
+	require.Equal(t, "HTTP_STATUS", journalFieldName("http.status"))
+	require.Equal(t, "PRIVATE", journalFieldName("_private"))
+	require.Equal(t, "F_1ST", journalFieldName("1st"))
+	require.Equal(t, "F_", journalFieldName("__"))
+	require.Equal(t, 64, len(journalFieldName(strings.Repeat("a", 100))))
+}
+
+func formatJSON(t *testing.T, e *logrus.Entry) map[string]interface{} {
+	b, err := newJSONFormatter(nil).Format(e)
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &m))
+	return m
+}
+
+func TestJSONErrorFields(t *testing.T) {
+	resetLevels(t)
+
+	cause := errors.New("connection refused")
+	e := testEntry()
+	e.Level = logrus.ErrorLevel
+	e.Data["error"] = errors.Wrap(
+		fmt.Errorf("dial master: %w", cause), "query failed")
+
+	m := formatJSON(t, e)
+	require.Equal(t,
+		"query failed: dial master: connection refused", m["error"])
+	require.DeepEqual(t, []interface{}{
+		"dial master: connection refused",
+		"connection refused",
+	}, m["error_causes"])
+	stack, ok := m["error_stack"].([]interface{})
+	require.True(t, ok)
+	// The innermost stack trace is rendered.
+	require.True(t, strings.HasPrefix(stack[0].(string),
+		"github.com/photon-storage/go-common/log.TestJSONErrorFields "))
+	require.True(t, strings.Contains(stack[0].(string), "format_test.go:"))
+	// The entry itself is left intact.
+	require.Equal(t, 2, len(e.Data))
+
+	// Stack traces are omitted below error level unless debug logging
+	// is enabled for the component.
+	e.Level = logrus.WarnLevel
+	m = formatJSON(t, e)
+	require.Equal(t, 2, len(m["error_causes"].([]interface{})))
+	require.Equal(t, nil, m["error_stack"])
+
+	require.NoError(t, SetComponentLevel("mysql", DebugLevel))
+	e.Data[componentKey] = "mysql"
+	m = formatJSON(t, e)
+	require.NotNil(t, m["error_stack"])
+
+	// Unwrapped errors render as their message only.
+	e.Data = logrus.Fields{"error": errors.New("closed")}
+	m = formatJSON(t, e)
+	require.Equal(t, "closed", m["error"])
+	require.Equal(t, nil, m["error_causes"])
+	require.Equal(t, nil, m["error_stack"])
+}
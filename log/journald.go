@@ -0,0 +1,137 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journaldHook sends entries to the systemd journal using the native
+// journal protocol. See systemd.journal-fields(7) and
+// https://systemd.io/JOURNAL_NATIVE_PROTOCOL/.
+//
+// Entries the journal rejects, e.g. for exceeding the datagram size,
+// are written to the fallback writer instead.
+type journaldHook struct {
+	conn       *net.UnixConn
+	identifier string
+	fallback   io.Writer
+	formatter  logrus.Formatter
+}
+
+// newJournaldHook connects to the journal socket. It fails if the
+// journal is not available, e.g. when not running under systemd.
+func newJournaldHook(
+	socket string,
+	fallback io.Writer,
+	formatter logrus.Formatter,
+) (*journaldHook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: socket,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldHook{
+		conn:       conn,
+		identifier: filepath.Base(os.Args[0]),
+		fallback:   fallback,
+		formatter:  formatter,
+	}, nil
+}
+
+func (h *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *journaldHook) Fire(e *logrus.Entry) error {
+	if _, err := h.conn.Write(h.encode(e)); err == nil {
+		return nil
+	}
+
+	b, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	_, err = h.fallback.Write(b)
+	return err
+}
+
+func (h *journaldHook) encode(e *logrus.Entry) []byte {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", e.Message)
+	writeJournalField(&b, "PRIORITY", journalPriority(e.Level))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", h.identifier)
+	for k, v := range e.Data {
+		writeJournalField(&b, journalFieldName(k), fmt.Sprint(v))
+	}
+	if e.HasCaller() {
+		writeJournalField(&b, "CODE_FILE", e.Caller.File)
+		writeJournalField(&b, "CODE_LINE", fmt.Sprint(e.Caller.Line))
+		writeJournalField(&b, "CODE_FUNC", e.Caller.Function)
+	}
+	return b.Bytes()
+}
+
+// writeJournalField appends a field. Values containing a newline use
+// the binary form with an explicit little-endian length.
+func writeJournalField(b *bytes.Buffer, name string, value string) {
+	b.WriteString(name)
+	if strings.ContainsRune(value, '\n') {
+		b.WriteByte('\n')
+		binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	} else {
+		b.WriteByte('=')
+	}
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName maps a field key to a valid journal field name:
+// upper case letters, digits and underscores, not starting with an
+// underscore or digit, at most 64 characters.
+func journalFieldName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+
+	s := strings.TrimLeft(string(name), "_")
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "F_" + s
+	}
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
+
+func journalPriority(l logrus.Level) string {
+	switch l {
+	case logrus.PanicLevel:
+		return "0"
+	case logrus.FatalLevel:
+		return "2"
+	case logrus.ErrorLevel:
+		return "3"
+	case logrus.WarnLevel:
+		return "4"
+	case logrus.InfoLevel:
+		return "6"
+	default:
+		return "7"
+	}
+}
@@ -3,6 +3,8 @@ package log
 import (
 	"errors"
 	"strings"
+
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -32,6 +34,10 @@ const (
 	TraceLevel
 )
 
+func (l Level) String() string {
+	return logrus.Level(l).String()
+}
+
 // ParseLevel takes a string level and returns the Logrus log level constant.
 func ParseLevel(lvl string) (Level, error) {
 	switch strings.ToLower(lvl) {
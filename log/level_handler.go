@@ -0,0 +1,170 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type levelState struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+type levelRequest struct {
+	// Component is the component pattern. Empty sets the global level.
+	Component string `json:"component"`
+	Level     string `json:"level"`
+	// RevertAfter restores the previous level after the duration,
+	// e.g. "10m".
+	RevertAfter string `json:"revert_after"`
+}
+
+// pendingRevert restores a level when its timer fires. level and set
+// record the state before the first of consecutive temporary changes.
+type pendingRevert struct {
+	timer *time.Timer
+	level Level
+	set   bool
+}
+
+type levelHandler struct {
+	mu      sync.Mutex
+	reverts map[string]*pendingRevert
+}
+
+// LevelHandler serves the global and component log levels. It can be
+// mounted next to /metrics:
+//
+//	http.Handle("/log/level", log.LevelHandler())
+//
+// GET returns the levels. PUT or POST changes a level from a JSON
+// body such as {"component": "mysql", "level": "debug",
+// "revert_after": "10m"}; without a component the global level is
+// changed. DELETE removes the level of the "component" query
+// parameter. All methods respond with the resulting levels.
+func LevelHandler() http.Handler {
+	return &levelHandler{
+		reverts: map[string]*pendingRevert{},
+	}
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPut, http.MethodPost:
+		var req levelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.set(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+	case http.MethodDelete:
+		component := r.URL.Query().Get("component")
+		if component == "" {
+			http.Error(w, "component is required", http.StatusBadRequest)
+			return
+		}
+		h.reset(component)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state := levelState{
+		Level:      GetLevel().String(),
+		Components: map[string]string{},
+	}
+	for p, l := range ComponentLevels() {
+		state.Components[p] = l.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+func (h *levelHandler) set(req levelRequest) error {
+	level, err := ParseLevel(req.Level)
+	if err != nil {
+		return err
+	}
+
+	var revertAfter time.Duration
+	if req.RevertAfter != "" {
+		if revertAfter, err = time.ParseDuration(req.RevertAfter); err != nil {
+			return err
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prev, prevSet := currentLevel(req.Component)
+	if p := h.reverts[req.Component]; p != nil {
+		p.timer.Stop()
+		delete(h.reverts, req.Component)
+		prev, prevSet = p.level, p.set
+	}
+
+	if req.Component == "" {
+		SetLevel(level)
+	} else if err := SetComponentLevel(req.Component, level); err != nil {
+		return err
+	}
+
+	if revertAfter > 0 {
+		p := &pendingRevert{level: prev, set: prevSet}
+		p.timer = time.AfterFunc(revertAfter, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if h.reverts[req.Component] != p {
+				return
+			}
+			delete(h.reverts, req.Component)
+			restoreLevel(req.Component, p.level, p.set)
+			Info("Log level reverted", "component", req.Component)
+		})
+		h.reverts[req.Component] = p
+	}
+
+	return nil
+}
+
+func (h *levelHandler) reset(component string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if p := h.reverts[component]; p != nil {
+		p.timer.Stop()
+		delete(h.reverts, component)
+	}
+	ResetComponentLevel(component)
+}
+
+func currentLevel(component string) (Level, bool) {
+	if component == "" {
+		return GetLevel(), true
+	}
+	l, ok := ComponentLevels()[component]
+	return l, ok
+}
+
+func restoreLevel(component string, level Level, set bool) {
+	switch {
+	case component == "":
+		SetLevel(level)
+	case set:
+		SetComponentLevel(component, level)
+	default:
+		ResetComponentLevel(component)
+	}
+}
@@ -0,0 +1,198 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+// initTest installs a logger discarding its output and restores a
+// synchronous one when the test ends.
+func initTest(t *testing.T, opts *Options) {
+	require.NoError(t, Init(opts))
+	global().logger.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		require.NoError(t, Init(&Options{
+			LogLevel: InfoLevel,
+			Sync:     true,
+		}))
+		global().logger.SetOutput(io.Discard)
+	})
+}
+
+// blockingHook blocks writing entries at levels, or all levels if
+// empty, until unblock is closed.
+type blockingHook struct {
+	unblock chan struct{}
+	levels  []logrus.Level
+}
+
+func (h *blockingHook) Levels() []logrus.Level {
+	if len(h.levels) == 0 {
+		return logrus.AllLevels
+	}
+	return h.levels
+}
+
+func (h *blockingHook) Fire(*logrus.Entry) error {
+	<-h.unblock
+	return nil
+}
+
+func TestCloseDrains(t *testing.T) {
+	initTest(t, &Options{LogLevel: InfoLevel, BufferSize: 4})
+	hook := TestingHook(t)
+
+	for i := 0; i < 100; i++ {
+		Info("Entry", "i", i)
+	}
+	require.NoError(t, Close(context.Background()))
+	require.Equal(t, 100, len(hook.AllEntries()))
+
+	// Logging after close is synchronous and never blocks.
+	for i := 0; i < 10; i++ {
+		Info("After close")
+	}
+	require.Equal(t, 110, len(hook.AllEntries()))
+	require.Equal(t, "After close", hook.LastEntry().Message)
+
+	// Closing again is a no-op.
+	require.NoError(t, Close(context.Background()))
+}
+
+func TestLogAfterContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	initTest(t, &Options{
+		Context:    ctx,
+		LogLevel:   InfoLevel,
+		BufferSize: 2,
+	})
+	hook := TestingHook(t)
+
+	cancel()
+	WaitForDone()
+	for i := 0; i < 10; i++ {
+		Info("After cancel")
+	}
+	require.Equal(t, 10, len(hook.AllEntries()))
+}
+
+func TestFlush(t *testing.T) {
+	initTest(t, &Options{LogLevel: InfoLevel})
+	hook := TestingHook(t)
+
+	for i := 0; i < 20; i++ {
+		Info("Entry")
+	}
+	require.NoError(t, Flush(context.Background()))
+	require.Equal(t, 20, len(hook.AllEntries()))
+}
+
+func TestFlushOverflow(t *testing.T) {
+	initTest(t, &Options{
+		LogLevel:   InfoLevel,
+		BufferSize: 2,
+		Overflow:   OverflowDropOldest,
+	})
+	h := &blockingHook{unblock: make(chan struct{})}
+	global().logger.AddHook(h)
+
+	Info("Stuck")
+	errCh := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		errCh <- Flush(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// Overflowing the buffer must not evict the flush marker.
+	for i := 0; i < 10; i++ {
+		Info("Entry", "i", i)
+	}
+	close(h.unblock)
+	require.NoError(t, <-errCh)
+}
+
+func TestCloseDeadline(t *testing.T) {
+	initTest(t, &Options{LogLevel: InfoLevel})
+	h := &blockingHook{unblock: make(chan struct{})}
+	global().logger.AddHook(h)
+
+	Info("Stuck")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, context.DeadlineExceeded, Flush(ctx))
+	require.ErrorIs(t, context.DeadlineExceeded, Close(ctx))
+
+	close(h.unblock)
+	require.NoError(t, Close(context.Background()))
+}
+
+func TestConcurrentInit(t *testing.T) {
+	testConcurrentInit(t, ForceColor)
+}
+
+// testConcurrentInit logs and calls op from several goroutines while
+// the logger is re-initialized.
+func testConcurrentInit(t *testing.T, op func()) {
+	initTest(t, &Options{LogLevel: InfoLevel, BufferSize: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := Default().With("worker", i)
+			for ctx.Err() == nil {
+				l.Info("Working")
+				op()
+			}
+		}(i)
+	}
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, Init(&Options{
+			LogLevel:   InfoLevel,
+			BufferSize: i%3 + 1,
+			Overflow:   OverflowPolicy(i % 4),
+			Sync:       i%5 == 0,
+		}))
+		global().logger.SetOutput(io.Discard)
+		Info(fmt.Sprintf("Init %d", i))
+	}
+
+	cancel()
+	wg.Wait()
+	require.NoError(t, Close(context.Background()))
+}
+
+func TestEntryTimeAtCall(t *testing.T) {
+	initTest(t, &Options{LogLevel: InfoLevel})
+	h := &blockingHook{unblock: make(chan struct{})}
+	global().logger.AddHook(h)
+	hook := TestingHook(t)
+
+	Info("Stuck")
+	before := time.Now()
+	Info("Queued")
+	after := time.Now()
+	time.Sleep(50 * time.Millisecond)
+	close(h.unblock)
+	require.NoError(t, Flush(context.Background()))
+
+	// The entry is stamped when logged, not when written.
+	entries := hook.AllEntries()
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "Queued", entries[1].Message)
+	require.False(t, entries[1].Time.Before(before))
+	require.False(t, entries[1].Time.After(after))
+}
@@ -2,92 +2,283 @@ package log
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// The global logger
-var g *log
+// current holds the global *log. It is swapped atomically by Init
+// so concurrent logging never observes a partially built logger.
+var current atomic.Value
 
-const chSize int = 64
+func global() *log {
+	return current.Load().(*log)
+}
+
+const defaultBufferSize = 64
 
 type log struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 	logger    *logrus.Logger
-	entry     *logrus.Entry
 	opts      *Options
 	formatter *TimeZoneFormatter
-	ch        chan func()
-	doneCh    chan bool
+	backend   atomic.Value
+	sampler   atomic.Value
+	// level is the global Level. The logrus logger itself logs at
+	// trace level so component levels can be more verbose.
+	level uint32
+	ch    chan func()
+	// ctrl carries control closures such as flush markers. They are
+	// never buffered in ch so overflow policies cannot drop them.
+	ctrl   chan func()
+	doneCh chan bool
+
+	// mu guards closed. Senders hold the read lock while enqueueing
+	// so the buffer can be fully drained once closed is set.
+	mu      sync.RWMutex
+	closed  bool
+	closing chan struct{}
+
+	overflow           OverflowPolicy
+	overflowLevel      Level
+	dropReportInterval time.Duration
+}
+
+// backend replaces logrus as the destination of entries while level
+// filtering and the async channel still apply. See SetSlogBackend.
+type backend interface {
+	enabled(level logrus.Level) bool
+	emit(t time.Time, level logrus.Level, msg string, fields logrus.Fields)
+}
+
+// backendBox allows storing a nil backend in an atomic.Value.
+type backendBox struct {
+	backend backend
 }
 
-func (l *log) log(f func()) {
+func (l *log) loadBackend() backend {
+	b, _ := l.backend.Load().(backendBox)
+	return b.backend
+}
+
+// log writes f through the async buffer if enabled. Entries are
+// written synchronously once the logger is closed.
+func (l *log) log(level logrus.Level, f func()) {
 	if l.ch == nil {
 		f()
-	} else {
-		l.ch <- f
+		return
+	}
+
+	l.mu.RLock()
+	queued := !l.closed && l.enqueue(level, f)
+	l.mu.RUnlock()
+	if !queued {
+		f()
 	}
 }
 
 func (l *log) loop() {
-	if l.ch != nil {
-		defer close(l.doneCh)
-		for {
-			select {
-			case f := <-l.ch:
-				f()
-
-			case <-l.ctx.Done():
-				// Drain remaining logs in the channel.
-				for {
-					select {
-					case f := <-l.ch:
-						f()
-					default:
-						return
-					}
-				}
-			}
+	defer close(l.doneCh)
+
+	ticker := time.NewTicker(l.dropReportInterval)
+	defer ticker.Stop()
+	lastDropped := Dropped()
+	defer l.reportDropped(&lastDropped)
+
+	for {
+		select {
+		case f := <-l.ch:
+			f()
+
+		case f := <-l.ctrl:
+			l.drainBuffered()
+			f()
+
+		case <-ticker.C:
+			l.reportDropped(&lastDropped)
+			l.reportSuppressed(false)
+
+		case <-l.ctx.Done():
+			l.shutdown()
+			return
+		}
+	}
+}
+
+// shutdown stops accepting entries and drains the buffer.
+func (l *log) shutdown() {
+	// Release senders blocked on a full buffer first, otherwise they
+	// would hold the read lock forever.
+	close(l.closing)
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+
+	for {
+		select {
+		case f := <-l.ch:
+			f()
+		default:
+			l.reportSuppressed(true)
+			return
+		}
+	}
+}
+
+// drainBuffered writes the entries buffered when called. Entries
+// enqueued before a control closure was sent are among them unless
+// already written or dropped, as the buffer is FIFO.
+func (l *log) drainBuffered() {
+	for n := len(l.ch); n > 0; n-- {
+		select {
+		case f := <-l.ch:
+			f()
+		default:
+			return
 		}
 	}
 }
 
-func (l *log) stop() {
+// control runs f on the loop goroutine after the entries buffered
+// before the call are written. It returns false if the logger is
+// closing or ctx is done before the loop received f.
+func (l *log) control(ctx context.Context, f func()) bool {
+	select {
+	case l.ctrl <- f:
+		return true
+	case <-l.closing:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close stops the loop and waits for buffered entries to be written.
+func (l *log) close(ctx context.Context) error {
 	l.cancel()
+	if l.doneCh == nil {
+		l.reportSuppressed(true)
+		return nil
+	}
+
+	select {
+	case <-l.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush waits for entries buffered before the call to be written.
+func (l *log) flush(ctx context.Context) error {
+	if l.ch == nil {
+		l.reportSuppressed(true)
+		return nil
+	}
+
+	done := make(chan struct{})
+	l.mu.RLock()
+	if !l.closed {
+		l.control(ctx, func() {
+			l.reportSuppressed(true)
+			close(done)
+		})
+	}
+	l.mu.RUnlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-l.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newLogger(opts *Options) *log {
+	parent := opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+
+	l := &log{
+		ctx:                ctx,
+		cancel:             cancel,
+		opts:               opts,
+		closing:            make(chan struct{}),
+		level:              uint32(opts.LogLevel),
+		overflow:           opts.Overflow,
+		overflowLevel:      opts.OverflowLevel,
+		dropReportInterval: opts.DropReportInterval,
+	}
+	if l.dropReportInterval <= 0 {
+		l.dropReportInterval = defaultDropReportInterval
+	}
+	if l.overflow == OverflowDropBelowLevel && l.overflowLevel == PanicLevel {
+		l.overflowLevel = defaultOverflowLevel
+	}
+	l.sampler.Store(samplerBox{sampler: newSampler(opts.Sampling)})
+	return l
 }
 
 // Default initializer
 func init() {
 	logger := logrus.New()
-	logger.SetLevel(logrus.Level(InfoLevel))
+	logger.SetLevel(logrus.TraceLevel)
 	logger.SetOutput(io.Discard)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	g = &log{
-		ctx:    ctx,
-		cancel: cancel,
-		logger: logger,
-		entry:  logger.WithFields(logrus.Fields{}),
-	}
+	l := newLogger(&Options{LogLevel: InfoLevel, Sync: true})
+	l.logger = logger
+	current.Store(l)
 }
 
 type Options struct {
+	// Context stops async logging when done. See also Close.
 	Context    context.Context
 	LogLevel   Level
 	Sync       bool
 	ForceColor bool
 	Location   *time.Location
+	// Format selects the output format. Journald falls back to text
+	// on stdout if the journal is not available.
+	Format Format
+
+	// BufferSize is the capacity of the async buffer. Defaults to 64.
+	BufferSize int
+	// Overflow decides what happens to entries logged while the async
+	// buffer is full. Defaults to OverflowBlock.
+	Overflow OverflowPolicy
+	// OverflowLevel is the least severe level kept under
+	// OverflowDropBelowLevel. Defaults to ErrorLevel; PanicLevel is
+	// treated as unset as panic and fatal entries are never buffered.
+	OverflowLevel Level
+	// DropReportInterval is the interval of the warning reporting
+	// dropped entries. Defaults to 10s.
+	DropReportInterval time.Duration
+
+	// Sampling suppresses repeated entries if set.
+	Sampling *SamplingConfig
 }
 
-// Initialize the Logger
+// Initialize the Logger. It is safe to call while other goroutines
+// are logging. The previous logger writes its buffered entries in the
+// background.
 func Init(opts *Options) error {
-	if g != nil {
-		g.stop()
+	if opts.Format > JournaldFormat {
+		return ErrLogFormatInvalid
+	}
+	if opts.Overflow > OverflowDropBelowLevel {
+		return ErrOverflowPolicyInvalid
+	}
+	if err := opts.Sampling.validate(); err != nil {
+		return err
 	}
 
 	formatter := newTimeZoneFormatter(opts.Location)
@@ -98,153 +289,143 @@ func Init(opts *Options) error {
 
 	// Create new logger
 	logger := logrus.New()
-	logger.SetLevel(logrus.Level(opts.LogLevel))
+	logger.SetLevel(logrus.TraceLevel)
 	logger.SetFormatter(formatter)
 	logger.SetOutput(os.Stdout)
 
-	ctx, cancel := context.WithCancel(opts.Context)
-	g = &log{
-		ctx:       ctx,
-		cancel:    cancel,
-		logger:    logger,
-		entry:     logger.WithFields(logrus.Fields{}),
-		opts:      opts,
-		formatter: formatter,
+	var journalErr error
+	switch opts.Format {
+	case JsonFormat:
+		logger.SetFormatter(newJSONFormatter(opts.Location))
+	case FluentdFormat:
+		logger.SetFormatter(newFluentdFormatter(opts.Location))
+	case JournaldFormat:
+		hook, err := newJournaldHook(journalSocket, os.Stdout, formatter)
+		if err != nil {
+			journalErr = err
+			break
+		}
+		// The journal hook replaces stdout. Persistent logging
+		// still writes text to the file.
+		logger.AddHook(hook)
+		logger.SetOutput(io.Discard)
 	}
 
+	l := newLogger(opts)
+	l.logger = logger
+	l.formatter = formatter
+
 	if !opts.Sync {
-		g.ch = make(chan func(), chSize)
-		g.doneCh = make(chan bool)
-		go g.loop()
+		size := opts.BufferSize
+		if size <= 0 {
+			size = defaultBufferSize
+		}
+		l.ch = make(chan func(), size)
+		l.ctrl = make(chan func())
+		l.doneCh = make(chan bool)
+		go l.loop()
+	}
+
+	prev := global()
+	current.Store(l)
+	prev.cancel()
+
+	if journalErr != nil {
+		Warn("Journal not available, logging to stdout", "error", journalErr)
 	}
 
 	return nil
 }
 
-func WaitForDone() {
-	if g.doneCh != nil {
-		<-g.doneCh
-	}
+// Close stops async logging after writing all buffered entries.
+// Entries logged afterwards are written synchronously. It returns
+// ctx.Err() if ctx is done before the buffer is drained.
+func Close(ctx context.Context) error {
+	return global().close(ctx)
 }
 
-func ForceColor() {
-	g.formatter.formatter.ForceColors = true
-	g.formatter.formatter.DisableColors = false
-	g.logger.SetFormatter(g.formatter)
+// Flush waits until entries logged before the call are written, or
+// ctx is done.
+func Flush(ctx context.Context) error {
+	return global().flush(ctx)
 }
 
-func DisableColor() {
-	g.formatter.formatter.ForceColors = false
-	g.formatter.formatter.DisableColors = true
-	g.logger.SetFormatter(g.formatter)
+// WaitForDone closes the logger and waits for buffered entries to be
+// written. Prefer Close with a deadline.
+func WaitForDone() {
+	Close(context.Background())
 }
 
-func SetLevel(logLevel Level) {
-	g.logger.SetLevel(logrus.Level(logLevel))
+// ForceColor and DisableColor only apply to the text format.
+func ForceColor() {
+	global().setColors(true)
 }
 
-func GetLevel() Level {
-	return Level(g.logger.GetLevel())
+func DisableColor() {
+	global().setColors(false)
 }
 
-func withFields(params ...interface{}) *logrus.Entry {
-	fields := logrus.Fields{}
-	for i := 0; i+1 < len(params); i += 2 {
-		val := params[i]
-		key, ok := val.(string)
-		if !ok {
-			key = fmt.Sprintf("%v", val)
-		}
-		fields[key] = params[i+1]
+// setColors installs a new formatter instead of mutating the current
+// one, which may be in use by the loop goroutine.
+func (l *log) setColors(force bool) {
+	if !l.isText() {
+		return
 	}
 
-	return g.logger.WithFields(fields)
+	f := newTimeZoneFormatter(l.formatter.loc)
+	f.formatter.ForceColors = force
+	f.formatter.DisableColors = !force
+	l.logger.SetFormatter(f)
 }
 
-func Trace(v string, params ...interface{}) {
-	if !g.logger.IsLevelEnabled(logrus.TraceLevel) {
-		return
-	}
+func (l *log) isText() bool {
+	return l.formatter != nil &&
+		(l.opts.Format == TextFormat ||
+			l.opts.Format == JournaldFormat)
+}
 
-	g.log(func() {
-		if len(params) > 1 {
-			withFields(params...).Trace(v)
-		} else {
-			g.entry.Trace(v)
-		}
-	})
+// SetLevel sets the level of entries without a component level.
+// See SetComponentLevel.
+func SetLevel(logLevel Level) {
+	atomic.StoreUint32(&global().level, uint32(logLevel))
+}
+
+func GetLevel() Level {
+	return Level(atomic.LoadUint32(&global().level))
 }
 
 func IsDebug() bool {
-	return g.logger.IsLevelEnabled(logrus.DebugLevel)
+	return std.enabled(logrus.DebugLevel)
 }
 
-func Debug(v string, params ...interface{}) {
-	if !g.logger.IsLevelEnabled(logrus.DebugLevel) {
-		return
-	}
+func Trace(v string, params ...interface{}) {
+	std.Trace(v, params...)
+}
 
-	g.log(func() {
-		if len(params) > 1 {
-			withFields(params...).Debug(v)
-		} else {
-			g.entry.Debug(v)
-		}
-	})
+func Debug(v string, params ...interface{}) {
+	std.Debug(v, params...)
 }
 
 func Info(v string, params ...interface{}) {
-	if !g.logger.IsLevelEnabled(logrus.InfoLevel) {
-		return
-	}
-
-	g.log(func() {
-		if len(params) > 1 {
-			withFields(params...).Info(v)
-		} else {
-			g.entry.Info(v)
-		}
-	})
+	std.Info(v, params...)
 }
 
 func Warn(v string, params ...interface{}) {
-	if !g.logger.IsLevelEnabled(logrus.WarnLevel) {
-		return
-	}
-
-	g.log(func() {
-		if len(params) > 1 {
-			withFields(params...).Warn(v)
-		} else {
-			g.entry.Warn(v)
-		}
-	})
+	std.Warn(v, params...)
 }
 
 func Error(v string, params ...interface{}) {
-	if !g.logger.IsLevelEnabled(logrus.ErrorLevel) {
-		return
-	}
-
-	g.log(func() {
-		if len(params) > 1 {
-			withFields(params...).Error(v)
-		} else {
-			g.entry.Error(v)
-		}
-	})
+	std.Error(v, params...)
 }
 
+// Fatal logs the entry, then exits the process with status 1. Pending
+// async entries are written first.
 func Fatal(v string, params ...interface{}) {
-	if !g.logger.IsLevelEnabled(logrus.FatalLevel) {
-		return
-	}
+	std.Fatal(v, params...)
+}
 
-	g.log(func() {
-		if len(params) > 1 {
-			withFields(params...).Fatal(v)
-		} else {
-			g.entry.Fatal(v)
-		}
-	})
+// Panic logs the entry, then panics with the message. Pending async
+// entries are written first.
+func Panic(v string, params ...interface{}) {
+	std.Panic(v, params...)
 }
@@ -0,0 +1,212 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const componentKey = "component"
+
+// std is the default logger behind the package level functions.
+var std = &Logger{}
+
+type loggerKey struct{}
+
+// Logger logs with a fixed set of fields attached. Loggers are
+// immutable and safe for concurrent use. They write through the
+// global output configured by Init.
+type Logger struct {
+	fields    logrus.Fields
+	component string
+}
+
+// Default returns the logger used by the package level functions.
+func Default() *Logger {
+	return std
+}
+
+// With returns a logger adding the given key/value pairs to every
+// entry. Later values override earlier ones with the same key.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if len(keyvals) < 2 {
+		return l
+	}
+
+	fields := make(logrus.Fields, len(l.fields)+len(keyvals)/2)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	addFields(fields, keyvals)
+
+	return &Logger{
+		fields:    fields,
+		component: l.component,
+	}
+}
+
+// Named returns a logger for a sub-component. Names are joined with
+// dots and logged in the "component" field, e.g. "mysql.health".
+func (l *Logger) Named(component string) *Logger {
+	name := component
+	if l.component != "" {
+		name = l.component + "." + component
+	}
+
+	nl := l.With(componentKey, name)
+	nl.component = name
+	return nl
+}
+
+// NewContext returns a context carrying the logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default
+// logger if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return std
+}
+
+func (l *Logger) Trace(v string, params ...interface{}) {
+	l.logAt(logrus.TraceLevel, v, params)
+}
+
+func (l *Logger) Debug(v string, params ...interface{}) {
+	l.logAt(logrus.DebugLevel, v, params)
+}
+
+func (l *Logger) Info(v string, params ...interface{}) {
+	l.logAt(logrus.InfoLevel, v, params)
+}
+
+func (l *Logger) Warn(v string, params ...interface{}) {
+	l.logAt(logrus.WarnLevel, v, params)
+}
+
+func (l *Logger) Error(v string, params ...interface{}) {
+	l.logAt(logrus.ErrorLevel, v, params)
+}
+
+// Fatal logs the entry, then exits the process with status 1. See
+// SetExitFunc.
+func (l *Logger) Fatal(v string, params ...interface{}) {
+	l.logAt(logrus.FatalLevel, v, params)
+}
+
+// Panic logs the entry, then panics with the message.
+func (l *Logger) Panic(v string, params ...interface{}) {
+	l.logAt(logrus.PanicLevel, v, params)
+}
+
+// IsEnabled reports whether entries at the level are logged.
+func (l *Logger) IsEnabled(level Level) bool {
+	return l.enabled(logrus.Level(level))
+}
+
+// enabled checks level against the component level of the logger,
+// falling back to the global level.
+func (l *Logger) enabled(level logrus.Level) bool {
+	max := GetLevel()
+	if l.component != "" {
+		if cl, ok := componentLevel(l.component); ok {
+			max = cl
+		}
+	}
+	return level <= logrus.Level(max)
+}
+
+func (l *Logger) logAt(level logrus.Level, v string, params []interface{}) {
+	if level <= logrus.FatalLevel {
+		l.terminate(level, v, params)
+		return
+	}
+
+	if !l.enabled(level) {
+		return
+	}
+
+	lg := global()
+	if s := lg.loadSampler(); s != nil {
+		ok, summary := s.allow(level, v)
+		if summary != nil {
+			std.write(lg, logrus.WarnLevel, suppressedMsg, summary.params())
+		}
+		if !ok {
+			return
+		}
+	}
+
+	l.write(lg, level, v, params)
+}
+
+// write sends an entry to the output of lg, bypassing level checks
+// and sampling.
+func (l *Logger) write(
+	lg *log,
+	level logrus.Level,
+	v string,
+	params []interface{},
+) {
+	if f := l.entryFunc(lg, level, v, params); f != nil {
+		lg.log(level, f)
+	}
+}
+
+// entryFunc returns a function writing the entry, or nil if the
+// backend does not accept the level.
+func (l *Logger) entryFunc(
+	lg *log,
+	level logrus.Level,
+	v string,
+	params []interface{},
+) func() {
+	// The time is taken on the calling goroutine as the entry may be
+	// written later by the log loop.
+	now := time.Now()
+	fields := l.entryFields(params)
+	if b := lg.loadBackend(); b != nil {
+		if !b.enabled(level) {
+			return nil
+		}
+		return func() {
+			b.emit(now, level, v, fields)
+		}
+	}
+
+	return func() {
+		lg.logger.WithFields(fields).WithTime(now).Log(level, v)
+	}
+}
+
+func (l *Logger) entryFields(params []interface{}) logrus.Fields {
+	if len(params) < 2 {
+		return l.fields
+	}
+
+	fields := make(logrus.Fields, len(l.fields)+len(params)/2)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	addFields(fields, params)
+	return fields
+}
+
+func addFields(fields logrus.Fields, keyvals []interface{}) {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		val := keyvals[i]
+		key, ok := val.(string)
+		if !ok {
+			key = fmt.Sprintf("%v", val)
+		}
+		fields[key] = keyvals[i+1]
+	}
+}
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestLogger(t *testing.T) {
+	hook := TestingHook(t)
+
+	base := Default().With("request_id", "abc")
+	l := base.Named("mysql").Named("health")
+	l.Warn("Replica lagging", "node", "slave0")
+
+	e := hook.LastEntry()
+	require.Equal(t, logrus.WarnLevel, e.Level)
+	require.Equal(t, "Replica lagging", e.Message)
+	require.Equal(t, "abc", e.Data["request_id"])
+	require.Equal(t, "mysql.health", e.Data["component"])
+	require.Equal(t, "slave0", e.Data["node"])
+
+	// Derived loggers do not alter their parents.
+	base.Info("Request done")
+	e = hook.LastEntry()
+	require.Equal(t, "abc", e.Data["request_id"])
+	require.Equal(t, nil, e.Data["component"])
+	require.Equal(t, nil, e.Data["node"])
+
+	// Per call fields override logger fields.
+	base.Info("Request done", "request_id", "def")
+	require.Equal(t, "def", hook.LastEntry().Data["request_id"])
+}
+
+func TestLoggerContext(t *testing.T) {
+	hook := TestingHook(t)
+
+	require.Equal(t, Default(), FromContext(context.Background()))
+
+	l := Default().With("request_id", "abc")
+	ctx := NewContext(context.Background(), l)
+	require.Equal(t, l, FromContext(ctx))
+
+	FromContext(ctx).Info("Handled")
+	require.Equal(t, "abc", hook.LastEntry().Data["request_id"])
+}
@@ -0,0 +1,386 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateConfig defines when a RotatingFile rotates and which backups
+// it keeps. Zero values disable the respective limit.
+type RotateConfig struct {
+	// MaxSize is the size in bytes at which the file is rotated.
+	MaxSize int64 `yaml:"max_size"`
+	// Interval rotates the file at multiples of the interval, e.g.
+	// every day at midnight UTC for 24h.
+	Interval time.Duration `yaml:"interval"`
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int `yaml:"max_backups"`
+	// MaxAge removes rotated files older than the given duration.
+	MaxAge time.Duration `yaml:"max_age"`
+	// Compress gzips rotated files.
+	Compress bool `yaml:"compress"`
+	// ReopenSignal reopens the file when received, e.g. syscall.SIGHUP
+	// for external rotation by logrotate. Unset by default as it
+	// replaces the default action of the signal for the process.
+	ReopenSignal os.Signal `yaml:"-"`
+}
+
+// RotatingFile is an io.Writer appending to a file and rotating it as
+// configured. Rotated files are renamed to name-<timestamp>.ext in the
+// same directory, with a counter before .ext if a backup of the same
+// millisecond exists. It is safe for concurrent use.
+type RotatingFile struct {
+	path string
+	cfg  RotateConfig
+	now  func() time.Time
+
+	mu sync.Mutex
+	// f is nil if the file is closed or reopening it failed, in which
+	// case it is reopened on the next write.
+	f        *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+
+	// millMu serializes compression and cleanup of backups, which run
+	// in the background after a rotation.
+	millMu sync.Mutex
+	wg     sync.WaitGroup
+	sigCh  chan os.Signal
+}
+
+// NewRotatingFile opens or creates the file at path for appending.
+func NewRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path: path,
+		cfg:  cfg,
+		now:  time.Now,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	if cfg.ReopenSignal != nil {
+		r.ReopenOnSignal(cfg.ReopenSignal)
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = info.Size()
+	r.openedAt = r.now()
+	return nil
+}
+
+// ensureOpen reopens the file if a previous reopen failed.
+func (r *RotatingFile) ensureOpen() error {
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.f == nil {
+		return r.open()
+	}
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.ensureOpen(); err != nil {
+		return 0, err
+	}
+
+	if r.shouldRotate(int64(len(p))) {
+		// A failed rotation is retried on the next write. If the
+		// file could not be reopened, so is reopening it.
+		if err := r.rotate(); err != nil && r.f == nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.cfg.MaxSize > 0 && r.size > 0 && r.size+n > r.cfg.MaxSize {
+		return true
+	}
+	if r.cfg.Interval > 0 {
+		return !r.now().Truncate(r.cfg.Interval).
+			Equal(r.openedAt.Truncate(r.cfg.Interval))
+	}
+	return false
+}
+
+// Rotate rotates the file immediately.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.ensureOpen(); err != nil {
+		return err
+	}
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+
+	if err := os.Rename(r.path, r.backupName(r.now())); err != nil {
+		// Keep writing to the current file.
+		if oerr := r.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.mill()
+	}()
+	return nil
+}
+
+// Reopen closes and reopens the file without rotating it. This is
+// for external tools such as logrotate that move the file away.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			return err
+		}
+		r.f = nil
+	}
+	return r.open()
+}
+
+// ReopenOnSignal reopens the file whenever one of the signals is
+// received, until the file is closed.
+func (r *RotatingFile) ReopenOnSignal(sigs ...os.Signal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sigCh != nil {
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	r.sigCh = ch
+
+	go func() {
+		for range ch {
+			if err := r.Reopen(); err != nil {
+				Error("Error reopening log file", "file_name", r.path, "error", err)
+			}
+		}
+	}()
+}
+
+// Close closes the file and waits for background compression and
+// cleanup of backups.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	r.closed = true
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	if r.sigCh != nil {
+		signal.Stop(r.sigCh)
+		close(r.sigCh)
+		r.sigCh = nil
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+func (r *RotatingFile) prefixAndExt() (string, string) {
+	base := filepath.Base(r.path)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// backupName returns an unused backup path for a rotation at t.
+func (r *RotatingFile) backupName(t time.Time) string {
+	prefix, ext := r.prefixAndExt()
+	base := filepath.Join(
+		filepath.Dir(r.path),
+		prefix+t.UTC().Format(backupTimeFormat),
+	)
+	for seq := 0; ; seq++ {
+		path := base + ext
+		if seq > 0 {
+			path = base + "." + strconv.Itoa(seq) + ext
+		}
+		if !exists(path) && !exists(path+".gz") {
+			return path
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+type backup struct {
+	path string
+	t    time.Time
+	seq  int
+}
+
+// backups lists rotated files, newest first.
+func (r *RotatingFile) backups() ([]backup, error) {
+	dir := filepath.Dir(r.path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, ext := r.prefixAndExt()
+	var bs []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		ts := strings.TrimPrefix(name, prefix)
+		ts = strings.TrimSuffix(ts, ".gz")
+		if !strings.HasSuffix(ts, ext) {
+			continue
+		}
+		ts = strings.TrimSuffix(ts, ext)
+		if len(ts) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, ts[:len(backupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		seq := 0
+		if suffix := ts[len(backupTimeFormat):]; suffix != "" {
+			seq, err = strconv.Atoi(strings.TrimPrefix(suffix, "."))
+			if err != nil || suffix[0] != '.' || seq <= 0 {
+				continue
+			}
+		}
+		bs = append(bs, backup{
+			path: filepath.Join(dir, name),
+			t:    t,
+			seq:  seq,
+		})
+	}
+
+	sort.Slice(bs, func(i, j int) bool {
+		if bs[i].t.Equal(bs[j].t) {
+			return bs[i].seq > bs[j].seq
+		}
+		return bs[i].t.After(bs[j].t)
+	})
+	return bs, nil
+}
+
+// mill compresses backups and removes the ones beyond the configured
+// limits.
+func (r *RotatingFile) mill() {
+	r.millMu.Lock()
+	defer r.millMu.Unlock()
+
+	bs, err := r.backups()
+	if err != nil {
+		Error("Error listing log backups", "file_name", r.path, "error", err)
+		return
+	}
+
+	cutoff := time.Time{}
+	if r.cfg.MaxAge > 0 {
+		cutoff = r.now().Add(-r.cfg.MaxAge)
+	}
+	for i, b := range bs {
+		if r.cfg.MaxBackups > 0 && i >= r.cfg.MaxBackups ||
+			!cutoff.IsZero() && b.t.Before(cutoff) {
+			if err := os.Remove(b.path); err != nil {
+				Error("Error removing log backup", "file_name", b.path, "error", err)
+			}
+			continue
+		}
+
+		if r.cfg.Compress && !strings.HasSuffix(b.path, ".gz") {
+			if err := compressFile(b.path); err != nil {
+				Error("Error compressing log backup", "file_name", b.path, "error", err)
+			}
+		}
+	}
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
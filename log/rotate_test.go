@@ -0,0 +1,217 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestRotatingFile(
+	t *testing.T,
+	cfg RotateConfig,
+) (*RotatingFile, *fakeClock, string) {
+	dir := t.TempDir()
+	clock := &fakeClock{t: time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)}
+	r, err := NewRotatingFile(filepath.Join(dir, "node.log"), cfg)
+	require.NoError(t, err)
+	r.now = clock.now
+	r.openedAt = clock.now()
+	t.Cleanup(func() { r.Close() })
+	return r, clock, dir
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func write(t *testing.T, r *RotatingFile, s string) {
+	_, err := r.Write([]byte(s))
+	require.NoError(t, err)
+}
+
+func TestRotateBySize(t *testing.T) {
+	r, clock, dir := newTestRotatingFile(t, RotateConfig{MaxSize: 10})
+
+	write(t, r, "line one\n")
+	require.DeepEqual(t, []string{"node.log"}, listDir(t, dir))
+
+	clock.t = clock.t.Add(time.Second)
+	write(t, r, "line two\n")
+	r.wg.Wait()
+	require.DeepEqual(t, []string{
+		"node-2022-10-01T12-00-01.000.log",
+		"node.log",
+	}, listDir(t, dir))
+
+	b, err := os.ReadFile(filepath.Join(dir, "node.log"))
+	require.NoError(t, err)
+	require.Equal(t, "line two\n", string(b))
+
+	// An entry larger than MaxSize is written to a fresh file.
+	clock.t = clock.t.Add(time.Second)
+	write(t, r, "a very long line\n")
+	r.wg.Wait()
+	require.Equal(t, 3, len(listDir(t, dir)))
+}
+
+func TestRotateByInterval(t *testing.T) {
+	r, clock, dir := newTestRotatingFile(t, RotateConfig{Interval: time.Hour})
+
+	write(t, r, "a\n")
+	clock.t = clock.t.Add(59 * time.Minute)
+	write(t, r, "b\n")
+	require.Equal(t, 1, len(listDir(t, dir)))
+
+	clock.t = clock.t.Add(time.Minute)
+	write(t, r, "c\n")
+	r.wg.Wait()
+	require.DeepEqual(t, []string{
+		"node-2022-10-01T13-00-00.000.log",
+		"node.log",
+	}, listDir(t, dir))
+}
+
+func TestRotateRetention(t *testing.T) {
+	r, clock, dir := newTestRotatingFile(t, RotateConfig{
+		MaxBackups: 2,
+		MaxAge:     time.Hour,
+		Compress:   true,
+	})
+
+	for i := 0; i < 4; i++ {
+		clock.t = clock.t.Add(time.Minute)
+		write(t, r, "entry\n")
+		require.NoError(t, r.Rotate())
+		r.wg.Wait()
+	}
+	require.DeepEqual(t, []string{
+		"node-2022-10-01T12-03-00.000.log.gz",
+		"node-2022-10-01T12-04-00.000.log.gz",
+		"node.log",
+	}, listDir(t, dir))
+
+	f, err := os.Open(filepath.Join(dir, "node-2022-10-01T12-04-00.000.log.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, "entry\n", string(b))
+
+	// Backups older than MaxAge are removed.
+	clock.t = clock.t.Add(time.Hour + time.Minute)
+	require.NoError(t, r.Rotate())
+	r.wg.Wait()
+	require.DeepEqual(t, []string{
+		"node-2022-10-01T13-05-00.000.log.gz",
+		"node.log",
+	}, listDir(t, dir))
+}
+
+func TestRotateSameMillisecond(t *testing.T) {
+	r, _, dir := newTestRotatingFile(t, RotateConfig{MaxBackups: 2})
+
+	for _, s := range []string{"a\n", "b\n", "c\n"} {
+		write(t, r, s)
+		require.NoError(t, r.Rotate())
+		r.wg.Wait()
+	}
+	// The oldest backup is removed and the others are kept.
+	require.DeepEqual(t, []string{
+		"node-2022-10-01T12-00-00.000.1.log",
+		"node-2022-10-01T12-00-00.000.2.log",
+		"node.log",
+	}, listDir(t, dir))
+
+	b, err := os.ReadFile(
+		filepath.Join(dir, "node-2022-10-01T12-00-00.000.2.log"))
+	require.NoError(t, err)
+	require.Equal(t, "c\n", string(b))
+}
+
+func TestReopenAfterFailure(t *testing.T) {
+	r, _, dir := newTestRotatingFile(t, RotateConfig{})
+	path := filepath.Join(dir, "node.log")
+
+	// Reopening fails while the path points into a missing directory.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing", "node.log"), path))
+	require.ErrorIs(t, os.ErrNotExist, r.Reopen())
+	_, err := r.Write([]byte("lost\n"))
+	require.ErrorIs(t, os.ErrNotExist, err)
+
+	// The next write reopens the file.
+	require.NoError(t, os.Remove(path))
+	write(t, r, "after\n")
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "after\n", string(b))
+}
+
+func TestReopen(t *testing.T) {
+	r, _, dir := newTestRotatingFile(t, RotateConfig{})
+
+	write(t, r, "before\n")
+	require.NoError(t, os.Rename(
+		filepath.Join(dir, "node.log"),
+		filepath.Join(dir, "node.log.1"),
+	))
+	require.NoError(t, r.Reopen())
+	write(t, r, "after\n")
+
+	b, err := os.ReadFile(filepath.Join(dir, "node.log"))
+	require.NoError(t, err)
+	require.Equal(t, "after\n", string(b))
+
+	require.NoError(t, r.Close())
+	_, err = r.Write([]byte("closed\n"))
+	require.ErrorIs(t, os.ErrClosed, err)
+}
+
+func TestReopenSignal(t *testing.T) {
+	// Signals are left alone unless configured.
+	r, _, _ := newTestRotatingFile(t, RotateConfig{})
+	require.True(t, r.sigCh == nil)
+
+	r, _, dir := newTestRotatingFile(t, RotateConfig{
+		ReopenSignal: syscall.SIGUSR1,
+	})
+	write(t, r, "before\n")
+	require.NoError(t, os.Rename(
+		filepath.Join(dir, "node.log"),
+		filepath.Join(dir, "node.log.1"),
+	))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join(dir, "node.log")); err == nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("log file not reopened on signal")
+}
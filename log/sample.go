@@ -0,0 +1,276 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSamplingInterval = time.Second
+
+	suppressedMsg = "Log entries suppressed"
+)
+
+var (
+	ErrSamplingInvalid = errors.New("invalid sampling config")
+
+	// sampled and rateLimited count entries suppressed by sampling
+	// and by rate limits.
+	sampled     uint64
+	rateLimited uint64
+)
+
+// SamplingConfig limits the volume of repeated entries. Fatal and
+// panic entries are never suppressed. The number of suppressed
+// entries is logged once their window ends, with the next entry or
+// at the latest with the dropped entries report (see
+// Options.DropReportInterval), and on Flush and Close.
+type SamplingConfig struct {
+	// Interval is the sampling window. Defaults to 1s.
+	Interval time.Duration
+	// First entries with the same level and message are logged per
+	// interval, then every Thereafter-th. Sampling is disabled if
+	// both are zero. A zero Thereafter drops all entries after First.
+	First      int
+	Thereafter int
+	// RateLimits caps the rate of entries per level.
+	RateLimits map[Level]RateLimit
+}
+
+// RateLimit is a token bucket refilled at Rate entries per second,
+// holding up to Burst entries. Rate must be positive. Burst defaults
+// to Rate, at least 1.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Suppressed returns the number of entries suppressed by sampling and
+// by rate limits since the process started.
+func Suppressed() (sampledCount uint64, rateLimitedCount uint64) {
+	return atomic.LoadUint64(&sampled), atomic.LoadUint64(&rateLimited)
+}
+
+// SetSampling replaces the sampling configuration of the current
+// logger. nil disables sampling. Entries suppressed under the
+// previous configuration are reported.
+func SetSampling(cfg *SamplingConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	l := global()
+	prev := l.loadSampler()
+	l.sampler.Store(samplerBox{sampler: newSampler(cfg)})
+	if prev != nil {
+		l.writeSuppressed(prev.pending(true))
+	}
+	return nil
+}
+
+func (c *SamplingConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	for level, rl := range c.RateLimits {
+		if rl.Rate <= 0 {
+			return fmt.Errorf("%w: rate limit of %v level is not positive",
+				ErrSamplingInvalid, level)
+		}
+	}
+	return nil
+}
+
+// reportSuppressed logs the number of suppressed entries whose window
+// ended, or all pending ones if force is set. It writes synchronously.
+func (l *log) reportSuppressed(force bool) {
+	if s := l.loadSampler(); s != nil {
+		l.writeSuppressed(s.pending(force))
+	}
+}
+
+func (l *log) writeSuppressed(summary *suppressedSummary) {
+	if summary == nil {
+		return
+	}
+	f := std.entryFunc(l, logrus.WarnLevel, suppressedMsg, summary.params())
+	if f != nil {
+		f()
+	}
+}
+
+type samplerBox struct {
+	sampler *sampler
+}
+
+func (l *log) loadSampler() *sampler {
+	s, _ := l.sampler.Load().(samplerBox)
+	return s.sampler
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type samplerKey struct {
+	level logrus.Level
+	msg   string
+}
+
+type sampler struct {
+	cfg SamplingConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[samplerKey]int
+	buckets     map[logrus.Level]*tokenBucket
+	// Entries suppressed in the current window.
+	sampled     uint64
+	rateLimited uint64
+}
+
+func newSampler(cfg *SamplingConfig) *sampler {
+	if cfg == nil {
+		return nil
+	}
+
+	s := &sampler{
+		cfg:     *cfg,
+		now:     time.Now,
+		counts:  map[samplerKey]int{},
+		buckets: map[logrus.Level]*tokenBucket{},
+	}
+	if s.cfg.Interval <= 0 {
+		s.cfg.Interval = defaultSamplingInterval
+	}
+	for level, rl := range cfg.RateLimits {
+		burst := float64(rl.Burst)
+		if burst <= 0 {
+			burst = rl.Rate
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		s.buckets[logrus.Level(level)] = &tokenBucket{
+			rate:   rl.Rate,
+			burst:  burst,
+			tokens: burst,
+		}
+	}
+	return s
+}
+
+// suppressedSummary counts entries suppressed in a finished window.
+type suppressedSummary struct {
+	sampled     uint64
+	rateLimited uint64
+}
+
+func (s *suppressedSummary) params() []interface{} {
+	return []interface{}{
+		"sampled", s.sampled,
+		"rate_limited", s.rateLimited,
+	}
+}
+
+// allow reports whether an entry is logged. When a sampling window
+// ends with suppressed entries, their counts are returned so the
+// caller can log a summary.
+func (s *sampler) allow(
+	level logrus.Level,
+	msg string,
+) (bool, *suppressedSummary) {
+	if level <= logrus.FatalLevel {
+		return true, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var summary *suppressedSummary
+	if now.Sub(s.windowStart) >= s.cfg.Interval {
+		summary = s.takeSummary()
+		s.windowStart = now
+		s.counts = map[samplerKey]int{}
+	}
+
+	if s.cfg.First > 0 || s.cfg.Thereafter > 0 {
+		key := samplerKey{level: level, msg: msg}
+		n := s.counts[key] + 1
+		s.counts[key] = n
+		if n > s.cfg.First &&
+			(s.cfg.Thereafter <= 0 || (n-s.cfg.First)%s.cfg.Thereafter != 0) {
+			s.sampled++
+			atomic.AddUint64(&sampled, 1)
+			return false, summary
+		}
+	}
+
+	if b := s.buckets[level]; b != nil && !b.allow(now) {
+		s.rateLimited++
+		atomic.AddUint64(&rateLimited, 1)
+		return false, summary
+	}
+
+	return true, summary
+}
+
+// pending returns the counts of suppressed entries once their window
+// ended, or right away if force is set. Returned counts are reset.
+func (s *sampler) pending(force bool) *suppressedSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= s.cfg.Interval {
+		s.windowStart = now
+		s.counts = map[samplerKey]int{}
+		return s.takeSummary()
+	}
+	if force {
+		return s.takeSummary()
+	}
+	return nil
+}
+
+// takeSummary returns and resets the suppressed counts, or nil if
+// there are none. s.mu must be held.
+func (s *sampler) takeSummary() *suppressedSummary {
+	if s.sampled == 0 && s.rateLimited == 0 {
+		return nil
+	}
+
+	summary := &suppressedSummary{
+		sampled:     s.sampled,
+		rateLimited: s.rateLimited,
+	}
+	s.sampled = 0
+	s.rateLimited = 0
+	return summary
+}
@@ -0,0 +1,162 @@
+package log
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestSamplerFirstThereafter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s := newSampler(&SamplingConfig{First: 2, Thereafter: 3})
+	s.now = clock.now
+
+	var allowed []int
+	for i := 1; i <= 10; i++ {
+		if ok, _ := s.allow(logrus.ErrorLevel, "Query failed"); ok {
+			allowed = append(allowed, i)
+		}
+	}
+	require.DeepEqual(t, []int{1, 2, 5, 8}, allowed)
+
+	// Keys are independent and fatal entries are never sampled.
+	ok, _ := s.allow(logrus.ErrorLevel, "Other")
+	require.True(t, ok)
+	ok, _ = s.allow(logrus.WarnLevel, "Query failed")
+	require.True(t, ok)
+	for i := 0; i < 5; i++ {
+		ok, _ = s.allow(logrus.FatalLevel, "Query failed")
+		require.True(t, ok)
+	}
+
+	// The next window resets counts and reports the suppressed ones.
+	clock.t = clock.t.Add(time.Second)
+	ok, summary := s.allow(logrus.ErrorLevel, "Query failed")
+	require.True(t, ok)
+	require.DeepEqual(t, &suppressedSummary{sampled: 6}, summary)
+
+	_, summary = s.allow(logrus.ErrorLevel, "Query failed")
+	require.Equal(t, (*suppressedSummary)(nil), summary)
+}
+
+func TestSamplerRateLimit(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s := newSampler(&SamplingConfig{
+		Interval: time.Minute,
+		RateLimits: map[Level]RateLimit{
+			InfoLevel: {Rate: 10, Burst: 2},
+		},
+	})
+	s.now = clock.now
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if ok, _ := s.allow(logrus.InfoLevel, "Request"); ok {
+			allowed++
+		}
+	}
+	require.Equal(t, 2, allowed)
+
+	clock.t = clock.t.Add(100 * time.Millisecond)
+	ok, _ := s.allow(logrus.InfoLevel, "Request")
+	require.True(t, ok)
+	ok, _ = s.allow(logrus.InfoLevel, "Request")
+	require.False(t, ok)
+
+	// Other levels are not limited.
+	for i := 0; i < 5; i++ {
+		ok, _ = s.allow(logrus.WarnLevel, "Request")
+		require.True(t, ok)
+	}
+
+	clock.t = clock.t.Add(time.Minute)
+	_, summary := s.allow(logrus.InfoLevel, "Request")
+	require.DeepEqual(t, &suppressedSummary{rateLimited: 4}, summary)
+}
+
+func TestSamplingSummary(t *testing.T) {
+	hook := TestingHook(t)
+	require.NoError(t, SetSampling(&SamplingConfig{Interval: time.Hour, First: 1}))
+	defer SetSampling(nil)
+
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	global().loadSampler().now = clock.now
+
+	sampledBefore, _ := Suppressed()
+	for i := 0; i < 5; i++ {
+		Error("Loop failed")
+	}
+	require.Equal(t, 1, len(hook.AllEntries()))
+	sampledAfter, _ := Suppressed()
+	require.Equal(t, sampledBefore+4, sampledAfter)
+
+	clock.t = clock.t.Add(time.Hour)
+	Error("Loop failed")
+	entries := hook.AllEntries()
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, "Log entries suppressed", entries[1].Message)
+	require.Equal(t, uint64(4), entries[1].Data["sampled"])
+	require.Equal(t, "Loop failed", entries[2].Message)
+}
+
+func TestSamplingSummaryOnFlush(t *testing.T) {
+	initTest(t, &Options{
+		LogLevel: InfoLevel,
+		Sampling: &SamplingConfig{Interval: time.Hour, First: 1},
+	})
+	hook := TestingHook(t)
+
+	for i := 0; i < 5; i++ {
+		Error("Loop failed")
+	}
+	require.NoError(t, Flush(context.Background()))
+
+	entries := hook.AllEntries()
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "Log entries suppressed", entries[1].Message)
+	require.Equal(t, uint64(4), entries[1].Data["sampled"])
+
+	// Nothing is left to report.
+	require.NoError(t, Close(context.Background()))
+	require.Equal(t, 2, len(hook.AllEntries()))
+}
+
+func TestSamplingSummaryTicker(t *testing.T) {
+	initTest(t, &Options{
+		LogLevel:           InfoLevel,
+		DropReportInterval: 5 * time.Millisecond,
+		Sampling: &SamplingConfig{
+			Interval: 20 * time.Millisecond,
+			First:    1,
+		},
+	})
+	hook := TestingHook(t)
+
+	for i := 0; i < 3; i++ {
+		Error("Loop failed")
+	}
+
+	// The summary is logged after the window ends without further
+	// entries.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if e := hook.LastEntry(); e != nil && e.Message == "Log entries suppressed" {
+			require.Equal(t, uint64(2), e.Data["sampled"])
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("suppressed entries not reported")
+}
+
+func TestSamplingInvalid(t *testing.T) {
+	cfg := &SamplingConfig{
+		RateLimits: map[Level]RateLimit{InfoLevel: {Burst: 5}},
+	}
+	require.ErrorIs(t, ErrSamplingInvalid, SetSampling(cfg))
+	require.ErrorIs(t, ErrSamplingInvalid, Init(&Options{Sampling: cfg}))
+}
@@ -0,0 +1,170 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SlogHandler is an slog.Handler writing records through this
+// package, so they share levels, formatting, the async channel and
+// file output with the rest of the logs. Groups are flattened into
+// dotted field names.
+type SlogHandler struct {
+	logger *Logger
+	prefix string
+	attrs  []interface{}
+}
+
+// NewSlogHandler creates an slog.Handler logging through l. If l is
+// nil, the logger carried by the record context is used, see
+// FromContext.
+//
+//	slog.SetDefault(slog.New(log.NewSlogHandler(nil)))
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{logger: l}
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	l := h.logger
+	if l == nil {
+		l = FromContext(ctx)
+	}
+	return l.enabled(fromSlogLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	l := h.logger
+	if l == nil {
+		l = FromContext(ctx)
+	}
+
+	keyvals := make([]interface{}, 0, len(h.attrs)+2*r.NumAttrs())
+	keyvals = append(keyvals, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		keyvals = appendAttr(keyvals, h.prefix, a)
+		return true
+	})
+
+	l.logAt(fromSlogLevel(r.Level), r.Message, keyvals)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	nh.attrs = append([]interface{}(nil), h.attrs...)
+	for _, a := range attrs {
+		nh.attrs = appendAttr(nh.attrs, h.prefix, a)
+	}
+	return &nh
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	nh := *h
+	nh.prefix = h.prefix + name + "."
+	return &nh
+}
+
+// appendAttr flattens a into key/value pairs.
+func appendAttr(keyvals []interface{}, prefix string, a slog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return keyvals
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		// Attributes of an unnamed group are inlined.
+		if a.Key != "" {
+			prefix = prefix + a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			keyvals = appendAttr(keyvals, prefix, ga)
+		}
+		return keyvals
+	}
+
+	return append(keyvals, prefix+a.Key, a.Value.Any())
+}
+
+func fromSlogLevel(l slog.Level) logrus.Level {
+	switch {
+	case l < slog.LevelDebug:
+		return logrus.TraceLevel
+	case l < slog.LevelInfo:
+		return logrus.DebugLevel
+	case l < slog.LevelWarn:
+		return logrus.InfoLevel
+	case l < slog.LevelError:
+		return logrus.WarnLevel
+	default:
+		return logrus.ErrorLevel
+	}
+}
+
+func toSlogLevel(l logrus.Level) slog.Level {
+	switch l {
+	case logrus.TraceLevel:
+		return slog.LevelDebug - 4
+	case logrus.DebugLevel:
+		return slog.LevelDebug
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	case logrus.ErrorLevel:
+		return slog.LevelError
+	default:
+		return slog.LevelError + 4
+	}
+}
+
+// SetSlogBackend makes the package write entries to h instead of the
+// output configured by Init. The log level set through Init or
+// SetLevel still applies. Passing nil restores the default output.
+// Init resets the backend.
+//
+// h must not itself log through this package, e.g. a SlogHandler,
+// or entries loop back forever.
+func SetSlogBackend(h slog.Handler) {
+	var b backend
+	if h != nil {
+		b = &slogBackend{handler: h}
+	}
+	global().backend.Store(backendBox{backend: b})
+}
+
+type slogBackend struct {
+	handler slog.Handler
+}
+
+func (b *slogBackend) enabled(level logrus.Level) bool {
+	return b.handler.Enabled(context.Background(), toSlogLevel(level))
+}
+
+func (b *slogBackend) emit(
+	t time.Time,
+	level logrus.Level,
+	msg string,
+	fields logrus.Fields,
+) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	r := slog.NewRecord(t, toSlogLevel(level), msg, 0)
+	for _, k := range keys {
+		r.AddAttrs(slog.Any(k, fields[k]))
+	}
+	b.handler.Handle(context.Background(), r)
+}
@@ -0,0 +1,105 @@
+//go:build go1.21
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/photon-storage/go-common/testing/require"
+)
+
+func TestSlogHandler(t *testing.T) {
+	hook := TestingHook(t)
+
+	l := slog.New(NewSlogHandler(Default().Named("lib"))).
+		With("request_id", "abc").
+		WithGroup("http")
+	l.Warn("Slow request",
+		"status", 200,
+		slog.Group("peer", "addr", "10.0.0.1"),
+	)
+
+	e := hook.LastEntry()
+	require.Equal(t, logrus.WarnLevel, e.Level)
+	require.Equal(t, "Slow request", e.Message)
+	require.Equal(t, "lib", e.Data["component"])
+	require.Equal(t, "abc", e.Data["request_id"])
+	require.Equal(t, int64(200), e.Data["http.status"])
+	require.Equal(t, "10.0.0.1", e.Data["http.peer.addr"])
+
+	// Debug is below the default level.
+	l.Debug("Hidden")
+	require.Equal(t, "Slow request", hook.LastEntry().Message)
+}
+
+func TestSlogHandlerContext(t *testing.T) {
+	hook := TestingHook(t)
+
+	ctx := NewContext(
+		context.Background(),
+		Default().With("request_id", "abc"),
+	)
+	slog.New(NewSlogHandler(nil)).InfoContext(ctx, "Handled")
+	require.Equal(t, "abc", hook.LastEntry().Data["request_id"])
+}
+
+func TestSlogBackend(t *testing.T) {
+	var buf bytes.Buffer
+	SetSlogBackend(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	defer SetSlogBackend(nil)
+
+	Default().Named("db").Error("Query failed", "table", "users")
+	Debug("Hidden")
+	require.Equal(t,
+		"level=ERROR msg=\"Query failed\" component=db table=users\n",
+		buf.String(),
+	)
+}
+
+func TestSlogBackendConcurrentInit(t *testing.T) {
+	testConcurrentInit(t, func() {
+		SetSlogBackend(nil)
+	})
+}
+
+type recordHandler struct {
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *recordHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func TestSlogBackendTime(t *testing.T) {
+	h := &recordHandler{}
+	ts := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	(&slogBackend{handler: h}).emit(ts, logrus.InfoLevel, "Queued", nil)
+	require.Equal(t, 1, len(h.records))
+	require.Equal(t, ts, h.records[0].Time)
+}
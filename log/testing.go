@@ -13,6 +13,6 @@ func TestingHook(t *testing.T) *test.Hook {
 	require.True(t, true)
 
 	h := new(test.Hook)
-	g.logger.AddHook(h)
+	global().logger.AddHook(h)
 	return h
 }
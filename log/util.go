@@ -3,23 +3,28 @@ package log
 import (
 	"fmt"
 	"io"
-	"os"
 )
 
 // ConfigurePersistentLogging adds a log-to-file writer.
 // File content is identical to stdout.
 func ConfigurePersistentLogging(fn string, isMux bool) error {
+	return ConfigureRotatingLogging(fn, isMux, RotateConfig{})
+}
+
+// ConfigureRotatingLogging adds a log-to-file writer rotating the
+// file as configured.
+func ConfigureRotatingLogging(fn string, isMux bool, cfg RotateConfig) error {
 	Info("Logs will be made persistent", "file_name", fn)
 
-	f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	f, err := NewRotatingFile(fn, cfg)
 	if err != nil {
 		return err
 	}
 
 	if isMux {
-		g.logger.SetOutput(io.MultiWriter(g.logger.Out, f))
+		global().logger.SetOutput(io.MultiWriter(global().logger.Out, f))
 	} else {
-		g.logger.SetOutput(f)
+		global().logger.SetOutput(f)
 	}
 
 	Info("File logging initialized")
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"github.com/photon-storage/go-common/log"
+)
+
+// RegisterLogMetrics exports stats of the log package.
+func RegisterLogMetrics() {
+	NewCounterFunc("log_dropped_entries_total", func() float64 {
+		return float64(log.Dropped())
+	})
+	NewCounterFunc(
+		"log_suppressed_entries_total.reason#sampled",
+		func() float64 {
+			n, _ := log.Suppressed()
+			return float64(n)
+		},
+	)
+	NewCounterFunc(
+		"log_suppressed_entries_total.reason#rate_limited",
+		func() float64 {
+			_, n := log.Suppressed()
+			return float64(n)
+		},
+	)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,9 +17,11 @@ import (
 
 var (
 	metricNamespace = ""
+	mu              sync.RWMutex
 	counters        = map[string]prometheus.Counter{}
 	gauges          = map[string]prometheus.Gauge{}
 	histograms      = map[string]prometheus.Histogram{}
+	funcs           = map[string]bool{}
 
 	ElapsedBucketsInMs = []float64{
 		0, 10, 20, 30, 40, 50, 60, 70, 80, 90,
@@ -51,7 +54,15 @@ func Init(ctx context.Context, namespace string, port int) {
 }
 
 // NewCounter declares a new counter.
+// Declaring an existing counter is a no-op.
 func NewCounter(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if counters[name] != nil {
+		return
+	}
+
 	metricName, labels := parseName(name)
 	counters[name] = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace:   metricNamespace,
@@ -60,22 +71,54 @@ func NewCounter(name string) {
 	})
 }
 
+// NewCounterFunc declares a counter whose value is read from f on
+// every collection. f must be safe for concurrent use and return
+// monotonically increasing values.
+func NewCounterFunc(name string, f func() float64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if funcs[name] {
+		return
+	}
+
+	metricName, labels := parseName(name)
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace:   metricNamespace,
+		Name:        metricName,
+		ConstLabels: labels,
+	}, f)
+	funcs[name] = true
+}
+
 func CounterInc(name string) {
+	mu.RLock()
 	c := counters[name]
+	mu.RUnlock()
 	if c != nil {
 		c.Inc()
 	}
 }
 
 func CounterAdd(name string, v float64) {
+	mu.RLock()
 	c := counters[name]
+	mu.RUnlock()
 	if c != nil {
 		c.Add(v)
 	}
 }
 
 // NewGauge declares a new gauge.
+// Declaring an existing gauge is a no-op.
 func NewGauge(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if gauges[name] != nil {
+		return
+	}
+
 	metricName, labels := parseName(name)
 	gauges[name] = promauto.NewGauge(prometheus.GaugeOpts{
 		Namespace:   metricNamespace,
@@ -84,29 +127,56 @@ func NewGauge(name string) {
 	})
 }
 
+// NewGaugeFunc declares a gauge whose value is read from f on every
+// collection. f must be safe for concurrent use.
+func NewGaugeFunc(name string, f func() float64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if funcs[name] {
+		return
+	}
+
+	metricName, labels := parseName(name)
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricNamespace,
+		Name:        metricName,
+		ConstLabels: labels,
+	}, f)
+	funcs[name] = true
+}
+
 func GaugeInc(name string) {
+	mu.RLock()
 	g := gauges[name]
+	mu.RUnlock()
 	if g != nil {
 		g.Inc()
 	}
 }
 
 func GaugeDec(name string) {
+	mu.RLock()
 	g := gauges[name]
+	mu.RUnlock()
 	if g != nil {
 		g.Dec()
 	}
 }
 
 func GaugeAdd(name string, v float64) {
+	mu.RLock()
 	g := gauges[name]
+	mu.RUnlock()
 	if g != nil {
 		g.Add(v)
 	}
 }
 
 func GaugeSet(name string, v float64) {
+	mu.RLock()
 	g := gauges[name]
+	mu.RUnlock()
 	if g != nil {
 		g.Set(v)
 	}
@@ -123,14 +193,24 @@ func GaugeSet(name string, v float64) {
 // otherwise the default is no buckets. (In other words, if you want to
 // use both reguler buckets and buckets for a native histogram, you have
 // to define the regular buckets here explicitly.)
+// Declaring an existing histogram is a no-op.
 func NewHistogram(
 	name string,
 	buckets ...float64,
 ) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if histograms[name] != nil {
+		return
+	}
+
+	metricName, labels := parseName(name)
 	histograms[name] = promauto.NewHistogram(prometheus.HistogramOpts{
-		Namespace: metricNamespace,
-		Name:      name,
-		Buckets:   buckets,
+		Namespace:   metricNamespace,
+		Name:        metricName,
+		ConstLabels: labels,
+		Buckets:     buckets,
 	})
 }
 
@@ -139,7 +219,9 @@ type number interface {
 }
 
 func HistAdd[T number](name string, v T) {
+	mu.RLock()
 	h := histograms[name]
+	mu.RUnlock()
 	if h != nil {
 		h.Observe(float64(v))
 	}
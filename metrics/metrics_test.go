@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/photon-storage/go-common/testing/require"
@@ -32,3 +33,32 @@ func TestParseName(t *testing.T) {
 	require.Equal(t, "value0", labels["label0"])
 	require.Equal(t, "value2", labels["label2"])
 }
+
+func TestDeclareIdempotent(t *testing.T) {
+	NewCounter("test_idempotent_total.kind#a")
+	NewCounter("test_idempotent_total.kind#a")
+	NewCounter("test_idempotent_total.kind#b")
+	CounterInc("test_idempotent_total.kind#a")
+
+	NewHistogram("test_idempotent_ms.kind#a", ElapsedBucketsInMs...)
+	NewHistogram("test_idempotent_ms.kind#a", ElapsedBucketsInMs...)
+	HistAdd("test_idempotent_ms.kind#a", 15)
+
+	v := 0.0
+	NewGaugeFunc("test_idempotent_func.kind#a", func() float64 { return v })
+	NewGaugeFunc("test_idempotent_func.kind#a", func() float64 { return v })
+
+	require.Equal(t, 2, countDeclared("test_idempotent_total", counters))
+	require.Equal(t, 1, countDeclared("test_idempotent_ms", histograms))
+	require.True(t, funcs["test_idempotent_func.kind#a"])
+}
+
+func countDeclared[T any](prefix string, m map[string]T) int {
+	n := 0
+	for name := range m {
+		if strings.HasPrefix(name, prefix+".") {
+			n++
+		}
+	}
+	return n
+}